@@ -0,0 +1,258 @@
+package grestclient
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//Authenticator adds credentials to a request. It is called after the
+//body has been marshaled and the RequestMutators have run, so it sees
+//the request exactly as it will be sent.
+type Authenticator interface {
+	Authenticate(r *http.Request) error
+}
+
+//AuthenticatorFunc lets a plain func be used as an Authenticator.
+type AuthenticatorFunc func(r *http.Request) error
+
+func (f AuthenticatorFunc) Authenticate(r *http.Request) error {
+	return f(r)
+}
+
+//SetAuthenticator sets the Authenticator used for every request.
+//Clones of the client share it. Pass nil to remove it.
+func (c *Client) SetAuthenticator(a Authenticator) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.auth = a
+}
+
+//Authenticator returns the Authenticator set on the client.
+func (c *Client) Authenticator() Authenticator {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.auth
+}
+
+//authenticate runs the client's Authenticator. Without one the user
+//and password in the base url, if any, are sent with basic auth.
+func (c *Client) authenticate(r *http.Request) error {
+	if c.auth != nil {
+		return c.auth.Authenticate(r)
+	}
+	if r.URL.User != nil && r.Header.Get("Authorization") == "" {
+		password, _ := r.URL.User.Password()
+		r.SetBasicAuth(r.URL.User.Username(), password)
+	}
+	return nil
+}
+
+//reauthenticator is implemented by Authenticators that can get new
+//credentials after a request was answered with a 401, like OAuth2.
+type reauthenticator interface {
+	Reauthenticate(r *http.Request) error
+}
+
+//retryUnauthorized sends r once more when it was answered with a 401
+//and the client's Authenticator can get new credentials. Otherwise res
+//is returned as it is.
+func (c *Client) retryUnauthorized(r *http.Request, res *http.Response) (*http.Response, error) {
+	re, ok := c.auth.(reauthenticator)
+	if !ok || res.StatusCode != http.StatusUnauthorized ||
+		(r.Body != nil && r.Body != http.NoBody && r.GetBody == nil) {
+		return res, nil
+	}
+
+	next := r.Clone(r.Context())
+	if r.GetBody != nil {
+		body, err := r.GetBody()
+		if err != nil {
+			return res, nil
+		}
+		next.Body = body
+	}
+	if err := re.Reauthenticate(next); err != nil {
+		res.Body.Close()
+		return nil, err
+	}
+	discard(res.Body)
+	return c.roundTrip(next)
+}
+
+//BasicAuth sends a username and password with HTTP basic auth.
+type BasicAuth struct {
+	Username string
+	Password string
+}
+
+func (a BasicAuth) Authenticate(r *http.Request) error {
+	r.SetBasicAuth(a.Username, a.Password)
+	return nil
+}
+
+//BearerAuth sends a static token in the Authorization header.
+type BearerAuth struct {
+	Token string
+}
+
+func (a BearerAuth) Authenticate(r *http.Request) error {
+	r.Header.Set("Authorization", "Bearer "+a.Token)
+	return nil
+}
+
+//APIKeyAuth sends an api key in the Name header, or in the Name query
+//parameter if InQuery is true.
+type APIKeyAuth struct {
+	Name    string
+	Value   string
+	InQuery bool
+}
+
+func (a APIKeyAuth) Authenticate(r *http.Request) error {
+	if a.InQuery {
+		q := r.URL.Query()
+		q.Set(a.Name, a.Value)
+		r.URL.RawQuery = q.Encode()
+		return nil
+	}
+	r.Header.Set(a.Name, a.Value)
+	return nil
+}
+
+//HMACAuth signs requests with an HMAC of the string returned by
+//StringToSign, which is made of the method, path, sorted query, hex
+//encoded sha256 of the body and a unix timestamp, each on its own line.
+//
+//The timestamp is sent in the TimestampHeader, the body hash in the
+//X-Content-Sha256 header and the signature in the Authorization header as
+//
+//	HMAC <KeyID>:<base64 signature>
+type HMACAuth struct {
+	KeyID  string
+	Secret []byte
+
+	//Hash defaults to sha256.New.
+	Hash func() hash.Hash
+	//TimestampHeader defaults to X-Timestamp.
+	TimestampHeader string
+	//Now defaults to time.Now. Useful for tests.
+	Now func() time.Time
+}
+
+func (a HMACAuth) Authenticate(r *http.Request) error {
+	now := time.Now
+	if a.Now != nil {
+		now = a.Now
+	}
+	timestamp := strconv.FormatInt(now().Unix(), 10)
+
+	bodyHash, err := BodySHA256(r)
+	if err != nil {
+		return err
+	}
+
+	h := a.Hash
+	if h == nil {
+		h = sha256.New
+	}
+	mac := hmac.New(h, a.Secret)
+	mac.Write([]byte(StringToSign(r, bodyHash, timestamp)))
+	signature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	r.Header.Set(a.timestampHeader(), timestamp)
+	r.Header.Set("X-Content-Sha256", bodyHash)
+	r.Header.Set("Authorization", "HMAC "+a.KeyID+":"+signature)
+	return nil
+}
+
+func (a HMACAuth) timestampHeader() string {
+	if a.TimestampHeader == "" {
+		return "X-Timestamp"
+	}
+	return a.TimestampHeader
+}
+
+//StringToSign returns what HMACAuth signs for r. Servers can use it to
+//check signatures.
+func StringToSign(r *http.Request, bodyHash string, timestamp string) string {
+	path := r.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	return strings.Join([]string{
+		r.Method,
+		path,
+		canonicalQuery(r.URL.Query()),
+		bodyHash,
+		timestamp,
+	}, "\n")
+}
+
+//canonicalQuery encodes q sorted by key and then by value.
+func canonicalQuery(q map[string][]string) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var pairs []string
+	for _, k := range keys {
+		values := append([]string(nil), q[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			pairs = append(pairs, queryEscape(k)+"="+queryEscape(v))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+//BodySHA256 returns the hex encoded sha256 of the body of r without
+//using it up. The body must be empty or be able to be read again through
+//GetBody, which is the case for marshaled bodies and Streams with an
+//Open func.
+func BodySHA256(r *http.Request) (string, error) {
+	sum := sha256.New()
+	if r.Body != nil && r.Body != http.NoBody {
+		if r.GetBody == nil {
+			return "", errors.New("Can't hash a request body that can't be read again.")
+		}
+		body, err := r.GetBody()
+		if err != nil {
+			return "", err
+		}
+		defer body.Close()
+		if _, err = io.Copy(sum, body); err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(sum.Sum(nil)), nil
+}
+
+//queryEscape escapes s the way RFC 3986 wants, with spaces as %20.
+func queryEscape(s string) string {
+	const hexDigits = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteByte('%')
+		b.WriteByte(hexDigits[c>>4])
+		b.WriteByte(hexDigits[c&15])
+	}
+	return b.String()
+}
@@ -0,0 +1,115 @@
+package grestclient
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuiltInAuthenticators(t *testing.T) {
+	var got *http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		got = req
+	}))
+	defer server.Close()
+
+	base, err := url.Parse(server.URL)
+	client, err := New(base)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client.SetAuthenticator(BasicAuth{Username: "user", Password: "pass"})
+	client.Get(&Params{Path: "basic"})
+	if u, p, ok := got.BasicAuth(); !ok || u != "user" || p != "pass" {
+		t.Fatal("Basic auth was not sent.")
+	}
+
+	client.SetAuthenticator(BearerAuth{Token: "token"})
+	client.Clone().Get(&Params{Path: "bearer"})
+	if got.Header.Get("Authorization") != "Bearer token" {
+		t.Fatal("Bearer token was not sent by the clone: ", got.Header.Get("Authorization"))
+	}
+
+	client.SetAuthenticator(APIKeyAuth{Name: "api_key", Value: "key", InQuery: true})
+	client.Get(&Params{Path: "key", Query: url.Values{"a": []string{"b"}}})
+	if got.URL.Query().Get("api_key") != "key" || got.URL.Query().Get("a") != "b" {
+		t.Fatal("Api key was not sent in the query: ", got.URL.RawQuery)
+	}
+}
+
+func TestBaseUrlCredentialsAreUsed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if u, p, ok := req.BasicAuth(); !ok || u != "me" || p != "secret" {
+			t.Fatal("Credentials from the base url were not sent.")
+		}
+	}))
+	defer server.Close()
+
+	base, err := url.Parse(strings.Replace(server.URL, "http://", "http://me:secret@", 1))
+	client, err := New(base)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = client.Get(&Params{Path: "get"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHMACAuthSignsBody(t *testing.T) {
+	secret := []byte("shh")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("X-Timestamp") != "1700000000" {
+			t.Fatal("Unexpected timestamp: ", req.Header.Get("X-Timestamp"))
+		}
+		bodyHash := req.Header.Get("X-Content-Sha256")
+		if bodyHash != "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824" {
+			t.Fatal("Unexpected body hash: ", bodyHash)
+		}
+
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(StringToSign(req, bodyHash, "1700000000")))
+		want := "HMAC key-1:" + base64.StdEncoding.EncodeToString(mac.Sum(nil))
+		if req.Header.Get("Authorization") != want {
+			t.Fatal("Unexpected signature: ", req.Header.Get("Authorization"))
+		}
+	}))
+	defer server.Close()
+
+	base, err := url.Parse(server.URL)
+	client, err := New(base)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.SetAuthenticator(HMACAuth{
+		KeyID:  "key-1",
+		Secret: secret,
+		Now:    func() time.Time { return time.Unix(1700000000, 0) },
+	})
+
+	_, err = client.Post(&Params{
+		Path:  "sign",
+		Query: url.Values{"b": []string{"2", "1"}, "a": []string{"x y"}},
+		Body:  "hello",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStringToSign(t *testing.T) {
+	r, _ := http.NewRequest("GET", "http://example.com/a%20b?z=1&a=2&a=1&s=x+y", nil)
+	want := "GET\n/a%20b\na=1&a=2&s=x%20y&z=1\nhash\n123"
+	if got := StringToSign(r, "hash", "123"); got != want {
+		t.Fatalf("Unexpected string to sign: %q", got)
+	}
+}
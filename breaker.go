@@ -0,0 +1,296 @@
+package grestclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+//ErrCircuitOpen is returned without calling the HttpDoer when a
+//CircuitBreaker is open, or half open with all its probes in flight.
+var ErrCircuitOpen = errors.New("grestclient: circuit open")
+
+//CircuitState is the state of a CircuitBreaker.
+type CircuitState int
+
+const (
+	//CircuitClosed lets every request through.
+	CircuitClosed CircuitState = iota
+	//CircuitOpen fails every request with ErrCircuitOpen.
+	CircuitOpen
+	//CircuitHalfOpen lets a few probe requests through to find out if
+	//the server is back.
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+//CircuitBreaker stops sending requests to a server that keeps failing.
+//
+//While closed it counts failures. It opens after ConsecutiveFailures
+//failures in a row, or once at least MinRequests were made in the
+//current Window and FailureRatio of them failed. After the CoolDown it
+//goes half open and lets Probes requests through: if they all succeed it
+//closes again and if one fails it opens for another CoolDown.
+//
+//A CircuitBreaker set on a client is shared by its clones. Every attempt
+//made by a RetryPolicy counts on its own. The fields must be set before
+//the breaker is used.
+type CircuitBreaker struct {
+	//ConsecutiveFailures opens the circuit after this many failures in a
+	//row. 0 turns it off.
+	ConsecutiveFailures int
+	//FailureRatio opens the circuit when this fraction of the requests in
+	//the Window failed. 0 turns it off.
+	FailureRatio float64
+	//MinRequests is how many requests are needed in the Window before the
+	//FailureRatio is looked at. Defaults to 10.
+	MinRequests int
+	//Window is how often the counts for the FailureRatio start over.
+	//Defaults to a minute.
+	Window time.Duration
+
+	//CoolDown is how long the circuit stays open. Defaults to 30 seconds.
+	CoolDown time.Duration
+	//Probes is how many requests are let through at once while half open
+	//and how many have to succeed to close the circuit. Defaults to 1.
+	Probes int
+
+	//IsFailure decides if an attempt failed. By default transport errors
+	//and 5xx statuses are failures. Errors from a done request Context
+	//or a RateLimiter are never counted.
+	IsFailure func(res *http.Response, err error) bool
+	//OnStateChange is called after the state changes. It must not block.
+	OnStateChange func(from CircuitState, to CircuitState)
+
+	mu          sync.Mutex
+	state       CircuitState
+	generation  int
+	opened      time.Time
+	windowStart time.Time
+	requests    int
+	failures    int
+	consecutive int
+	probes      int
+	successes   int
+	now         func() time.Time
+}
+
+//NewCircuitBreaker returns a CircuitBreaker that opens after
+//consecutiveFailures failures in a row and stays open for coolDown.
+func NewCircuitBreaker(consecutiveFailures int, coolDown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{ConsecutiveFailures: consecutiveFailures, CoolDown: coolDown}
+}
+
+//SetCircuitBreaker sets the CircuitBreaker used for requests that don't
+//match a path pattern set with SetPathCircuitBreaker. Pass nil to remove it.
+func (c *Client) SetCircuitBreaker(b *CircuitBreaker) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.breaker = b
+}
+
+//CircuitBreaker returns the CircuitBreaker set with SetCircuitBreaker.
+func (c *Client) CircuitBreaker() *CircuitBreaker {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.breaker
+}
+
+//SetPathCircuitBreaker sets the CircuitBreaker used for requests whose
+//url path matches pattern, as in path.Match, like "/v1/orders/*".
+//Patterns are tried in the order they were first set. Pass a nil breaker
+//to remove the pattern.
+func (c *Client) SetPathCircuitBreaker(pattern string, b *CircuitBreaker) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	routes, err := setPathRoute(c.pathBreakers, pattern, b)
+	if err != nil {
+		return err
+	}
+	c.pathBreakers = routes
+	return nil
+}
+
+func (c *Client) breakerFor(r *http.Request) *CircuitBreaker {
+	if b := matchPathRoute(c.pathBreakers, r.URL.Path); b != nil {
+		return b
+	}
+	return c.breaker
+}
+
+//State returns the current state of the breaker.
+func (b *CircuitBreaker) State() CircuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == CircuitOpen && !b.timeNow().Before(b.opened.Add(b.coolDown())) {
+		return CircuitHalfOpen
+	}
+	return b.state
+}
+
+//allow returns ErrCircuitOpen if a request can't be made right now.
+//Otherwise done has to be called with the outcome of the request.
+func (b *CircuitBreaker) allow() (done func(*http.Response, error), err error) {
+	b.mu.Lock()
+	var change func()
+	defer func() {
+		b.mu.Unlock()
+		if change != nil {
+			change()
+		}
+	}()
+
+	now := b.timeNow()
+	if b.state == CircuitOpen {
+		if now.Before(b.opened.Add(b.coolDown())) {
+			return nil, ErrCircuitOpen
+		}
+		change = b.setState(CircuitHalfOpen, now)
+	}
+
+	probe := false
+	if b.state == CircuitHalfOpen {
+		if b.probes >= b.maxProbes() {
+			return nil, ErrCircuitOpen
+		}
+		b.probes++
+		probe = true
+	}
+
+	generation := b.generation
+	return func(res *http.Response, err error) {
+		b.done(generation, probe, res, err)
+	}, nil
+}
+
+func (b *CircuitBreaker) done(generation int, probe bool, res *http.Response, err error) {
+	b.mu.Lock()
+	var change func()
+	defer func() {
+		b.mu.Unlock()
+		if change != nil {
+			change()
+		}
+	}()
+
+	if generation != b.generation {
+		//the state changed while the request was being made
+		return
+	}
+	if probe {
+		b.probes--
+	}
+	if errors.Is(err, ErrCanceled) || errors.Is(err, ErrRateLimited) ||
+		errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return
+	}
+
+	now := b.timeNow()
+	failed := b.failed(res, err)
+
+	if b.state == CircuitHalfOpen {
+		if failed {
+			change = b.setState(CircuitOpen, now)
+			return
+		}
+		b.successes++
+		if b.successes >= b.maxProbes() {
+			change = b.setState(CircuitClosed, now)
+		}
+		return
+	}
+
+	if window := b.window(); now.Sub(b.windowStart) >= window {
+		b.windowStart = now
+		b.requests, b.failures = 0, 0
+	}
+	b.requests++
+	if !failed {
+		b.consecutive = 0
+		return
+	}
+	b.failures++
+	b.consecutive++
+
+	if (b.ConsecutiveFailures > 0 && b.consecutive >= b.ConsecutiveFailures) ||
+		(b.FailureRatio > 0 && b.requests >= b.minRequests() &&
+			float64(b.failures)/float64(b.requests) >= b.FailureRatio) {
+		change = b.setState(CircuitOpen, now)
+	}
+}
+
+func (b *CircuitBreaker) failed(res *http.Response, err error) bool {
+	if b.IsFailure != nil {
+		return b.IsFailure(res, err)
+	}
+	return err != nil || res.StatusCode >= 500
+}
+
+//setState moves to state and returns a func calling OnStateChange, to
+//be called once b.mu is unlocked. b.mu must be held.
+func (b *CircuitBreaker) setState(state CircuitState, now time.Time) func() {
+	from := b.state
+	b.state = state
+	b.generation++
+	b.probes, b.successes = 0, 0
+	switch state {
+	case CircuitOpen:
+		b.opened = now
+	case CircuitClosed:
+		b.requests, b.failures, b.consecutive = 0, 0, 0
+		b.windowStart = now
+	}
+	if b.OnStateChange == nil {
+		return nil
+	}
+	callback := b.OnStateChange
+	return func() { callback(from, state) }
+}
+
+func (b *CircuitBreaker) timeNow() time.Time {
+	if b.now != nil {
+		return b.now()
+	}
+	return time.Now()
+}
+
+func (b *CircuitBreaker) coolDown() time.Duration {
+	if b.CoolDown > 0 {
+		return b.CoolDown
+	}
+	return 30 * time.Second
+}
+
+func (b *CircuitBreaker) maxProbes() int {
+	if b.Probes > 0 {
+		return b.Probes
+	}
+	return 1
+}
+
+func (b *CircuitBreaker) minRequests() int {
+	if b.MinRequests > 0 {
+		return b.MinRequests
+	}
+	return 10
+}
+
+func (b *CircuitBreaker) window() time.Duration {
+	if b.Window > 0 {
+		return b.Window
+	}
+	return time.Minute
+}
@@ -0,0 +1,152 @@
+package grestclient
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerOpensAndRecovers(t *testing.T) {
+	var calls int32
+	var status int32 = http.StatusBadGateway
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(int(atomic.LoadInt32(&status)))
+	}))
+	defer server.Close()
+
+	var changes []string
+	breaker := NewCircuitBreaker(3, time.Minute)
+	breaker.OnStateChange = func(from, to CircuitState) {
+		changes = append(changes, from.String()+">"+to.String())
+	}
+	now := time.Now()
+	breaker.now = func() time.Time { return now }
+
+	base, _ := url.Parse(server.URL)
+	client, _ := New(base)
+	client.SetCircuitBreaker(breaker)
+
+	for i := 0; i < 3; i++ {
+		if _, err := client.Get(&Params{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if breaker.State() != CircuitOpen {
+		t.Fatal("Circuit should be open after 3 failures: ", breaker.State())
+	}
+	if _, err := client.Clone().Get(&Params{}); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatal("Open circuit should fail the clone's request: ", err)
+	}
+	if calls != 3 {
+		t.Fatal("The server should not be called while the circuit is open: ", calls)
+	}
+
+	//the probe fails so the circuit opens again
+	now = now.Add(time.Minute)
+	client.Get(&Params{})
+	if breaker.State() != CircuitOpen || calls != 4 {
+		t.Fatal("Failed probe should open the circuit: ", breaker.State(), calls)
+	}
+
+	now = now.Add(time.Minute)
+	atomic.StoreInt32(&status, http.StatusOK)
+	if _, err := client.Get(&Params{}); err != nil {
+		t.Fatal(err)
+	}
+	if breaker.State() != CircuitClosed {
+		t.Fatal("Successful probe should close the circuit: ", breaker.State())
+	}
+
+	expected := []string{"closed>open", "open>half-open", "half-open>open", "open>half-open", "half-open>closed"}
+	if len(changes) != len(expected) {
+		t.Fatal("Wrong state changes: ", changes)
+	}
+	for i := range expected {
+		if changes[i] != expected[i] {
+			t.Fatal("Wrong state changes: ", changes)
+		}
+	}
+}
+
+func TestCircuitBreakerFailureRatio(t *testing.T) {
+	breaker := &CircuitBreaker{FailureRatio: 0.5, MinRequests: 4}
+	ok := &http.Response{StatusCode: 200}
+	failed := &http.Response{StatusCode: 500}
+
+	for _, res := range []*http.Response{ok, failed, ok} {
+		done, err := breaker.allow()
+		if err != nil {
+			t.Fatal(err)
+		}
+		done(res, nil)
+	}
+	if breaker.State() != CircuitClosed {
+		t.Fatal("Circuit should wait for MinRequests: ", breaker.State())
+	}
+
+	done, _ := breaker.allow()
+	done(failed, nil)
+	if breaker.State() != CircuitOpen {
+		t.Fatal("Circuit should open with half the requests failing: ", breaker.State())
+	}
+}
+
+func TestCircuitBreakerProbesAndIgnoredErrors(t *testing.T) {
+	breaker := &CircuitBreaker{ConsecutiveFailures: 1, Probes: 2}
+	now := time.Now()
+	breaker.now = func() time.Time { return now }
+
+	done, _ := breaker.allow()
+	done(nil, errors.New("connection refused"))
+	now = now.Add(time.Minute)
+
+	first, err := breaker.allow()
+	second, err2 := breaker.allow()
+	if err != nil || err2 != nil {
+		t.Fatal("Two probes should be let through: ", err, err2)
+	}
+	if _, err = breaker.allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatal("A third probe should not be let through: ", err)
+	}
+
+	//a canceled probe gives its place back without counting
+	first(nil, ErrCanceled)
+	third, err := breaker.allow()
+	if err != nil {
+		t.Fatal("The canceled probe's place should be free: ", err)
+	}
+	second(&http.Response{StatusCode: 200}, nil)
+	if breaker.State() != CircuitHalfOpen {
+		t.Fatal("One success should not close the circuit: ", breaker.State())
+	}
+	third(&http.Response{StatusCode: 204}, nil)
+	if breaker.State() != CircuitClosed {
+		t.Fatal("Two successes should close the circuit: ", breaker.State())
+	}
+}
+
+func TestPathCircuitBreaker(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/broken" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	base, _ := url.Parse(server.URL)
+	client, _ := New(base)
+	client.SetPathCircuitBreaker("/broken", NewCircuitBreaker(1, time.Minute))
+
+	client.Get(&Params{Path: "broken"})
+	if _, err := client.Get(&Params{Path: "broken"}); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatal("Circuit for the path should be open: ", err)
+	}
+	if _, err := client.Get(&Params{Path: "working"}); err != nil {
+		t.Fatal("Other paths should not be affected: ", err)
+	}
+}
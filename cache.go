@@ -0,0 +1,536 @@
+package grestclient
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//CacheStore keeps cached responses. Keys are made of the method and url
+//of a request and entries are opaque bytes. Implementations must be safe
+//for concurrent use.
+type CacheStore interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, entry []byte)
+	Delete(key string)
+}
+
+//Cache is a private HTTP cache following RFC 9111. It is added to a
+//client as Middleware:
+//
+//	cache := NewCache(NewMemoryCache(1000))
+//	c.Use(cache.Middleware())
+//
+//GET responses are stored when the server allows it and served from the
+//store while they are fresh according to Cache-Control max-age, Expires
+//or, failing those, a tenth of the time since Last-Modified. no-store is
+//honored in requests and responses and no-cache makes every use
+//revalidate. Responses with a Vary header are only served to requests
+//with the same values for those headers.
+//
+//Stale responses are revalidated by sending If-None-Match and
+//If-Modified-Since with the stored ETag and Last-Modified. A 304 is
+//answered with the stored response, so the UnmarshalMap destination for
+//its status gets the stored body. Within a stale-while-revalidate window
+//the stale response is served right away and revalidated in the
+//background.
+//
+//Requests with other methods go through, and a successful one removes
+//the stored response for its url. Requests with Params.KeepBodyOpen are
+//served from the store but their responses aren't stored. Neither are
+//responses bigger than the client's limit set with SetMaxBodySize.
+//
+//Entries are keyed on the method and url only, and the Authenticator runs
+//after Middleware, so the cache can't tell users apart. Responses to
+//requests with an Authorization header or made by a client with an
+//Authenticator are only stored if they are marked public or have an
+//s-maxage, like a shared cache does. That keeps a Cache shared by clients
+//made with Clone or With from handing one user's responses to another.
+type Cache struct {
+	store CacheStore
+	now   func() time.Time
+
+	revalidating sync.Map
+}
+
+//NewCache returns a Cache keeping responses in store.
+func NewCache(store CacheStore) *Cache {
+	return &Cache{store: store, now: time.Now}
+}
+
+//Middleware returns the Middleware serving requests from the cache.
+func (c *Cache) Middleware() Middleware {
+	return func(next Handler) Handler {
+		return func(r *http.Request, p *Params) (*http.Response, error) {
+			return c.handle(next, r, p)
+		}
+	}
+}
+
+func (c *Cache) handle(next Handler, r *http.Request, p *Params) (*http.Response, error) {
+	key := cacheKey(r)
+	if r.Method != "GET" {
+		response, err := next(r, p)
+		if err == nil && r.Method != "HEAD" && r.Method != "OPTIONS" && response.StatusCode < 400 {
+			c.store.Delete(key)
+		}
+		return response, err
+	}
+
+	requestCC := parseCacheControl(r.Header)
+	if _, ok := requestCC["no-store"]; ok ||
+		r.Header.Get("If-None-Match") != "" || r.Header.Get("If-Modified-Since") != "" ||
+		r.Header.Get("Range") != "" {
+		return next(r, p)
+	}
+
+	entry := c.load(key, r)
+	if entry != nil {
+		now := c.now()
+		age := entry.age(now)
+		lifetime := entry.lifetime()
+		responseCC := parseCacheControl(entry.Header)
+
+		_, requestNoCache := requestCC["no-cache"]
+		_, responseNoCache := responseCC["no-cache"]
+		revalidate := requestNoCache || responseNoCache
+		if maxAge, ok := seconds(requestCC, "max-age"); ok && age > maxAge {
+			revalidate = true
+		}
+
+		if !revalidate && age < lifetime {
+			return entry.response(r, age), nil
+		}
+		if swr, ok := seconds(responseCC, "stale-while-revalidate"); ok && !revalidate && age < lifetime+swr {
+			response := entry.response(r, age)
+			c.revalidate(next, key, r, p, entry)
+			return response, nil
+		}
+		r = entry.conditional(r)
+	}
+
+	requestTime := c.now()
+	response, err := next(r, p)
+	if err != nil {
+		return response, err
+	}
+	return c.update(key, r, p, entry, response, requestTime)
+}
+
+//update stores response, or the stored entry updated by a 304 response,
+//and returns what should be handed back to the caller.
+func (c *Cache) update(key string, r *http.Request, p *Params, entry *cacheEntry, response *http.Response, requestTime time.Time) (*http.Response, error) {
+	now := c.now()
+	if entry != nil && response.StatusCode == http.StatusNotModified {
+		io.Copy(ioutil.Discard, response.Body)
+		response.Body.Close()
+		entry = entry.refreshed(response.Header, requestTime, now)
+		c.save(key, entry)
+		return entry.response(r, entry.age(now)), nil
+	}
+
+	limit := requestInfoOf(r).maxBodySize
+	if p.KeepBodyOpen || !storable(r, response) || (limit > 0 && response.ContentLength > limit) {
+		if entry != nil {
+			c.store.Delete(key)
+		}
+		return response, nil
+	}
+
+	reader := io.Reader(response.Body)
+	if limit > 0 {
+		reader = io.LimitReader(response.Body, limit+1)
+	}
+	body, err := ioutil.ReadAll(reader)
+	if err != nil {
+		response.Body.Close()
+		return nil, canceled(r.Context(), err)
+	}
+	if limit > 0 && int64(len(body)) > limit {
+		//too big to store, the client fails it when it reads the rest
+		if entry != nil {
+			c.store.Delete(key)
+		}
+		response.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), response.Body), response.Body}
+		return response, nil
+	}
+	response.Body.Close()
+	response.Body = ioutil.NopCloser(bytes.NewReader(body))
+	response.ContentLength = int64(len(body))
+
+	c.save(key, &cacheEntry{
+		StatusCode:   response.StatusCode,
+		Header:       headerCopy(response.Header),
+		Body:         body,
+		RequestTime:  requestTime,
+		ResponseTime: now,
+		Vary:         varyValues(r, response.Header),
+	})
+	return response, nil
+}
+
+//revalidate refreshes entry in the background, once at a time per key.
+func (c *Cache) revalidate(next Handler, key string, r *http.Request, p *Params, entry *cacheEntry) {
+	if _, busy := c.revalidating.LoadOrStore(key, true); busy {
+		return
+	}
+	ctx, cancel := detach(r.Context())
+	background := entry.conditional(r.Clone(ctx))
+	params := *p
+	params.KeepBodyOpen = false
+
+	go func() {
+		defer cancel()
+		defer c.revalidating.Delete(key)
+		requestTime := c.now()
+		response, err := next(background, &params)
+		if err != nil {
+			return
+		}
+		if response, err = c.update(key, background, &params, entry, response, requestTime); err == nil {
+			response.Body.Close()
+		}
+	}()
+}
+
+func (c *Cache) load(key string, r *http.Request) *cacheEntry {
+	b, ok := c.store.Get(key)
+	if !ok {
+		return nil
+	}
+	entry := &cacheEntry{}
+	if err := json.Unmarshal(b, entry); err != nil {
+		c.store.Delete(key)
+		return nil
+	}
+	for name, values := range entry.Vary {
+		if strings.Join(r.Header.Values(name), ", ") != strings.Join(values, ", ") {
+			return nil
+		}
+	}
+	return entry
+}
+
+func (c *Cache) save(key string, entry *cacheEntry) {
+	if b, err := json.Marshal(entry); err == nil {
+		c.store.Set(key, b)
+	}
+}
+
+func cacheKey(r *http.Request) string {
+	u := *r.URL
+	u.Fragment = ""
+	return "GET " + u.String()
+}
+
+//cacheableStatus are the status codes that can be stored.
+var cacheableStatus = map[int]bool{
+	200: true, 203: true, 204: true, 300: true, 301: true, 308: true,
+	404: true, 405: true, 410: true, 414: true, 501: true,
+}
+
+//storable reports whether response to r can be stored and is worth it,
+//which it is if it has a lifetime or can be revalidated.
+func storable(r *http.Request, response *http.Response) bool {
+	if !cacheableStatus[response.StatusCode] {
+		return false
+	}
+	responseCC := parseCacheControl(response.Header)
+	if _, ok := responseCC["no-store"]; ok {
+		return false
+	}
+	if r.Header.Get("Authorization") != "" || requestInfoOf(r).authenticated {
+		_, private := responseCC["private"]
+		_, public := responseCC["public"]
+		_, sMaxAge := responseCC["s-maxage"]
+		if private || (!public && !sMaxAge) {
+			return false
+		}
+	}
+	for _, v := range response.Header.Values("Vary") {
+		if strings.Contains(v, "*") {
+			return false
+		}
+	}
+	_, maxAge := responseCC["max-age"]
+	return maxAge || response.Header.Get("Expires") != "" ||
+		response.Header.Get("ETag") != "" || response.Header.Get("Last-Modified") != ""
+}
+
+//varyValues returns the values of the request headers named by Vary.
+func varyValues(r *http.Request, header http.Header) http.Header {
+	var vary http.Header
+	for _, v := range header.Values("Vary") {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name == "" {
+				continue
+			}
+			if vary == nil {
+				vary = make(http.Header)
+			}
+			vary[http.CanonicalHeaderKey(name)] = r.Header.Values(name)
+		}
+	}
+	return vary
+}
+
+//parseCacheControl returns the Cache-Control directives in h with their
+//names lower cased and quotes taken off their values.
+func parseCacheControl(h http.Header) map[string]string {
+	directives := make(map[string]string)
+	for _, v := range h.Values("Cache-Control") {
+		for _, part := range strings.Split(v, ",") {
+			name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+			if name == "" {
+				continue
+			}
+			directives[strings.ToLower(name)] = strings.Trim(value, `"`)
+		}
+	}
+	return directives
+}
+
+//seconds returns the directive name of cc as a duration.
+func seconds(cc map[string]string, name string) (time.Duration, bool) {
+	v, ok := cc[name]
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return time.Duration(n) * time.Second, true
+}
+
+//cacheEntry is a stored response.
+type cacheEntry struct {
+	StatusCode   int
+	Header       http.Header
+	Body         []byte
+	RequestTime  time.Time
+	ResponseTime time.Time
+	Vary         http.Header
+}
+
+//lifetime is how long the response is fresh for.
+func (e *cacheEntry) lifetime() time.Duration {
+	cc := parseCacheControl(e.Header)
+	if maxAge, ok := seconds(cc, "max-age"); ok {
+		return maxAge
+	}
+	date, err := http.ParseTime(e.Header.Get("Date"))
+	if err != nil {
+		date = e.ResponseTime
+	}
+	if expires := e.Header.Get("Expires"); expires != "" {
+		t, err := http.ParseTime(expires)
+		if err != nil || !t.After(date) {
+			return 0
+		}
+		return t.Sub(date)
+	}
+	if modified, err := http.ParseTime(e.Header.Get("Last-Modified")); err == nil && date.After(modified) {
+		heuristic := date.Sub(modified) / 10
+		if heuristic > 24*time.Hour {
+			heuristic = 24 * time.Hour
+		}
+		return heuristic
+	}
+	return 0
+}
+
+//age is how old the response is at now.
+func (e *cacheEntry) age(now time.Time) time.Duration {
+	var apparent time.Duration
+	if date, err := http.ParseTime(e.Header.Get("Date")); err == nil && e.ResponseTime.After(date) {
+		apparent = e.ResponseTime.Sub(date)
+	}
+	corrected := e.ResponseTime.Sub(e.RequestTime)
+	if age, err := strconv.ParseInt(e.Header.Get("Age"), 10, 64); err == nil && age > 0 {
+		corrected += time.Duration(age) * time.Second
+	}
+	if apparent > corrected {
+		corrected = apparent
+	}
+	return corrected + now.Sub(e.ResponseTime)
+}
+
+//conditional returns a copy of r asking the server to send the response
+//only if it changed since e was stored.
+func (e *cacheEntry) conditional(r *http.Request) *http.Request {
+	etag := e.Header.Get("ETag")
+	modified := e.Header.Get("Last-Modified")
+	if etag == "" && modified == "" {
+		return r
+	}
+	r = r.Clone(r.Context())
+	if etag != "" {
+		r.Header.Set("If-None-Match", etag)
+	}
+	if modified != "" {
+		r.Header.Set("If-Modified-Since", modified)
+	}
+	return r
+}
+
+//refreshed returns a copy of e with the headers of a 304 response.
+func (e *cacheEntry) refreshed(header http.Header, requestTime time.Time, now time.Time) *cacheEntry {
+	next := *e
+	next.Header = headerCopy(e.Header)
+	for name, values := range header {
+		if name == "Content-Length" {
+			continue
+		}
+		next.Header[name] = values
+	}
+	next.RequestTime = requestTime
+	next.ResponseTime = now
+	return &next
+}
+
+//response returns the stored response for r.
+func (e *cacheEntry) response(r *http.Request, age time.Duration) *http.Response {
+	header := headerCopy(e.Header)
+	header.Set("Age", strconv.FormatInt(int64(age/time.Second), 10))
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode)),
+		StatusCode:    e.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       r,
+	}
+}
+
+//MemoryCache is a CacheStore keeping the most recently used entries in
+//memory.
+type MemoryCache struct {
+	max int
+
+	mu      sync.Mutex
+	entries *list.List
+	keys    map[string]*list.Element
+}
+
+type memoryCacheEntry struct {
+	key   string
+	value []byte
+}
+
+//NewMemoryCache returns a MemoryCache holding up to max entries. The
+//least recently used entry is dropped to make room for new ones.
+func NewMemoryCache(max int) *MemoryCache {
+	return &MemoryCache{max: max, entries: list.New(), keys: make(map[string]*list.Element)}
+}
+
+func (m *MemoryCache) Get(key string) ([]byte, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.keys[key]
+	if !ok {
+		return nil, false
+	}
+	m.entries.MoveToFront(e)
+	return e.Value.(*memoryCacheEntry).value, true
+}
+
+func (m *MemoryCache) Set(key string, value []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if e, ok := m.keys[key]; ok {
+		e.Value.(*memoryCacheEntry).value = value
+		m.entries.MoveToFront(e)
+		return
+	}
+	m.keys[key] = m.entries.PushFront(&memoryCacheEntry{key, value})
+	for m.max > 0 && m.entries.Len() > m.max {
+		oldest := m.entries.Back()
+		m.entries.Remove(oldest)
+		delete(m.keys, oldest.Value.(*memoryCacheEntry).key)
+	}
+}
+
+func (m *MemoryCache) Delete(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if e, ok := m.keys[key]; ok {
+		m.entries.Remove(e)
+		delete(m.keys, key)
+	}
+}
+
+//Len returns the number of entries.
+func (m *MemoryCache) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.entries.Len()
+}
+
+//DiskCache is a CacheStore keeping each entry in a file in a directory.
+type DiskCache struct {
+	dir string
+}
+
+//NewDiskCache returns a DiskCache keeping entries in dir, which is
+//created if needed.
+func NewDiskCache(dir string) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &DiskCache{dir: dir}, nil
+}
+
+func (d *DiskCache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(d.dir, hex.EncodeToString(sum[:]))
+}
+
+func (d *DiskCache) Get(key string) ([]byte, bool) {
+	b, err := ioutil.ReadFile(d.path(key))
+	if err != nil {
+		return nil, false
+	}
+	return b, true
+}
+
+//Set writes the entry to a temporary file first so readers never see
+//half of it.
+func (d *DiskCache) Set(key string, value []byte) {
+	f, err := ioutil.TempFile(d.dir, "tmp-")
+	if err != nil {
+		return
+	}
+	_, err = f.Write(value)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), d.path(key))
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+}
+
+func (d *DiskCache) Delete(key string) {
+	os.Remove(d.path(key))
+}
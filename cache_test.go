@@ -0,0 +1,364 @@
+package grestclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newCachedClient(t *testing.T, handler http.HandlerFunc) (*Client, *Cache, func(time.Duration), func()) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		//the server's clock would fight with the cache's fake one
+		w.Header()["Date"] = nil
+		handler(w, req)
+	}))
+	base, _ := url.Parse(server.URL)
+	client, _ := New(base)
+	client.SetCodecs(DefaultCodecs())
+
+	cache := NewCache(NewMemoryCache(10))
+	now := time.Now()
+	var mu sync.Mutex
+	cache.now = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+	advance := func(d time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		now = now.Add(d)
+	}
+	client.Use(cache.Middleware())
+	return client, cache, advance, server.Close
+}
+
+func TestCacheMaxAgeAndRevalidation(t *testing.T) {
+	var calls, notModified int32
+	client, _, advance, done := newCachedClient(t, func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if req.Header.Get("If-None-Match") == `"v1"` {
+			atomic.AddInt32(&notModified, 1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"name":"cached"}`)
+	})
+	defer done()
+
+	for i := 0; i < 3; i++ {
+		thing := &genericThing{}
+		res, err := client.Get(&Params{Path: "thing", UnmarshalMap: UnmarshalMap{200: thing}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.StatusCode != 200 || thing.Name != "cached" {
+			t.Fatal("Wrong response: ", res.StatusCode, thing)
+		}
+	}
+	if calls != 1 {
+		t.Fatal("Fresh response should be served from the cache: ", calls)
+	}
+
+	advance(2 * time.Minute)
+	thing := &genericThing{}
+	res, err := client.Get(&Params{Path: "thing", UnmarshalMap: UnmarshalMap{200: thing}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if notModified != 1 || res.StatusCode != 200 || thing.Name != "cached" {
+		t.Fatal("304 should be answered with the cached body: ", notModified, res.StatusCode, thing)
+	}
+
+	//the 304 made the entry fresh again
+	client.Get(&Params{Path: "thing"})
+	if calls != 2 {
+		t.Fatal("Revalidated response should be fresh: ", calls)
+	}
+
+	//a successful POST invalidates the cached response
+	client.Post(&Params{Path: "thing", Body: "x"})
+	client.Get(&Params{Path: "thing"})
+	if calls != 4 || notModified != 1 {
+		t.Fatal("Response should have been fetched again: ", calls, notModified)
+	}
+}
+
+func TestCacheNoStoreAndNoCache(t *testing.T) {
+	var calls int32
+	client, _, _, done := newCachedClient(t, func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		switch req.URL.Path {
+		case "/private":
+			w.Header().Set("Cache-Control", "no-store")
+		case "/validate":
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+			if req.Header.Get("If-Modified-Since") != "" {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
+		fmt.Fprint(w, "body")
+	})
+	defer done()
+
+	client.Get(&Params{Path: "private"})
+	client.Get(&Params{Path: "private"})
+	if calls != 2 {
+		t.Fatal("no-store response should not be cached: ", calls)
+	}
+
+	body := ""
+	client.Get(&Params{Path: "validate"})
+	res, _ := client.Get(&Params{Path: "validate", UnmarshalMap: UnmarshalMap{200: &body}})
+	if calls != 4 || res.StatusCode != 200 || body != "body" {
+		t.Fatal("no-cache response should be revalidated every time: ", calls, res.StatusCode, body)
+	}
+
+	client.Get(&Params{Path: "validate", Headers: http.Header{"Cache-Control": {"no-store"}}})
+	if calls != 5 {
+		t.Fatal("no-store request should skip the cache: ", calls)
+	}
+}
+
+func TestCacheVary(t *testing.T) {
+	var calls int32
+	client, _, _, done := newCachedClient(t, func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Vary", "Accept-Language")
+		fmt.Fprint(w, req.Header.Get("Accept-Language"))
+	})
+	defer done()
+
+	get := func(language string) string {
+		body := ""
+		client.Get(&Params{Headers: http.Header{"Accept-Language": {language}}, UnmarshalMap: UnmarshalMap{200: &body}})
+		return body
+	}
+	if get("en") != "en" || get("en") != "en" || calls != 1 {
+		t.Fatal("Same language should be served from the cache: ", calls)
+	}
+	if get("fr") != "fr" || calls != 2 {
+		t.Fatal("Other language should not get the cached response: ", calls)
+	}
+}
+
+func TestCacheStaleWhileRevalidate(t *testing.T) {
+	var version int32 = 1
+	revalidated := make(chan struct{}, 1)
+	client, _, advance, done := newCachedClient(t, func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=10, stale-while-revalidate=60")
+		fmt.Fprint(w, atomic.LoadInt32(&version))
+		if atomic.LoadInt32(&version) == 2 {
+			select {
+			case revalidated <- struct{}{}:
+			default:
+			}
+		}
+	})
+	defer done()
+
+	get := func() string {
+		body := ""
+		client.Get(&Params{UnmarshalMap: UnmarshalMap{200: &body}})
+		return body
+	}
+	get()
+	atomic.StoreInt32(&version, 2)
+	advance(20 * time.Second)
+
+	if body := get(); body != "1" {
+		t.Fatal("Stale response should be served while revalidating: ", body)
+	}
+	<-revalidated
+	for i := 0; i < 100 && get() != "2"; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	if body := get(); body != "2" {
+		t.Fatal("Response should have been revalidated in the background: ", body)
+	}
+}
+
+type cacheTestKey struct{}
+
+func TestCacheRevalidationKeepsContext(t *testing.T) {
+	revalidated := make(chan error, 1)
+	client, _, advance, done := newCachedClient(t, func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=10, stale-while-revalidate=60")
+		fmt.Fprint(w, "body")
+	})
+	defer done()
+	var calls int32
+	client.Use(func(next Handler) Handler {
+		return func(r *http.Request, p *Params) (*http.Response, error) {
+			if atomic.AddInt32(&calls, 1) == 2 {
+				_, deadline := r.Context().Deadline()
+				if r.Context().Value(cacheTestKey{}) != "trace" || !deadline {
+					t.Error("Revalidation should keep the values and deadline of the request.")
+				}
+				response, err := next(r, p)
+				revalidated <- err
+				return response, err
+			}
+			return next(r, p)
+		}
+	})
+
+	client.Get(&Params{})
+	advance(20 * time.Second)
+	ctx, cancel := context.WithTimeout(context.WithValue(context.Background(), cacheTestKey{}, "trace"), time.Minute)
+	client.Get(&Params{Context: ctx})
+	//the caller being done doesn't stop the revalidation
+	cancel()
+	if err := <-revalidated; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCacheSharedByClientsWithCredentials(t *testing.T) {
+	var calls int32
+	client, _, _, done := newCachedClient(t, func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if req.URL.Path == "/public" {
+			w.Header().Set("Cache-Control", "public, max-age=60")
+		} else {
+			w.Header().Set("Cache-Control", "max-age=60")
+		}
+		fmt.Fprint(w, req.Header.Get("Authorization"))
+	})
+	defer done()
+	client.SetAuthenticator(BearerAuth{Token: "a"})
+	other, _ := client.With(WithAuthenticator(BearerAuth{Token: "b"}))
+
+	body := ""
+	client.Get(&Params{Path: "private", UnmarshalMap: UnmarshalMap{200: &body}})
+	other.Get(&Params{Path: "private", UnmarshalMap: UnmarshalMap{200: &body}})
+	if body != "Bearer b" || calls != 2 {
+		t.Fatal("A response to one user was served to another: ", body, calls)
+	}
+
+	//responses the server marks public are shared
+	client.Get(&Params{Path: "public"})
+	other.Get(&Params{Path: "public", UnmarshalMap: UnmarshalMap{200: &body}})
+	if body != "Bearer a" || calls != 3 {
+		t.Fatal("Public response should have been served from the cache: ", body, calls)
+	}
+}
+
+func TestCacheKeepsToMaxBodySize(t *testing.T) {
+	client, cache, _, done := newCachedClient(t, func(w http.ResponseWriter, req *http.Request) {})
+	defer done()
+	var calls int32
+	var read int64
+	client.SetHttpDoer(&http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		atomic.AddInt32(&calls, 1)
+		body := io.LimitReader(zeros{}, 1<<20)
+		return &http.Response{
+			StatusCode:    200,
+			Header:        http.Header{"Cache-Control": {"max-age=60"}},
+			Body:          ioutil.NopCloser(readCounter{body, &read}),
+			ContentLength: -1,
+			Request:       r,
+		}, nil
+	})})
+	client.SetMaxBodySize(10)
+
+	for i := 0; i < 2; i++ {
+		body := ""
+		if _, err := client.Get(&Params{UnmarshalMap: UnmarshalMap{200: &body}}); !errors.Is(err, ErrBodyTooLarge) {
+			t.Fatal("Expected the body to be too large: ", err)
+		}
+	}
+	if calls != 2 || cache.store.(*MemoryCache).Len() != 0 {
+		t.Fatal("A body over the limit should not be stored: ", calls)
+	}
+	if read > 1<<10 {
+		t.Fatal("The whole body should not have been read: ", read)
+	}
+}
+
+type zeros struct{}
+
+func (zeros) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+type readCounter struct {
+	r io.Reader
+	n *int64
+}
+
+func (c readCounter) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	atomic.AddInt64(c.n, int64(n))
+	return n, err
+}
+
+func TestMemoryCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	m := NewMemoryCache(2)
+	m.Set("a", []byte("1"))
+	m.Set("b", []byte("2"))
+	m.Get("a")
+	m.Set("c", []byte("3"))
+	if _, ok := m.Get("b"); ok || m.Len() != 2 {
+		t.Fatal("b should have been evicted.")
+	}
+	if v, ok := m.Get("a"); !ok || string(v) != "1" {
+		t.Fatal("a should still be there.")
+	}
+}
+
+func TestDiskCache(t *testing.T) {
+	d, err := NewDiskCache(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Set("GET http://example.com/a?b=c", []byte("entry"))
+	if v, ok := d.Get("GET http://example.com/a?b=c"); !ok || string(v) != "entry" {
+		t.Fatal("Entry was not stored: ", string(v))
+	}
+	d.Delete("GET http://example.com/a?b=c")
+	if _, ok := d.Get("GET http://example.com/a?b=c"); ok {
+		t.Fatal("Entry was not deleted.")
+	}
+}
+
+func TestCacheBackgroundRevalidationUnderLogging(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=0, stale-while-revalidate=60")
+		fmt.Fprint(w, "body")
+	}))
+	defer server.Close()
+
+	base, _ := url.Parse(server.URL)
+	client, _ := New(base)
+	client.SetHttpDoer(http.DefaultClient)
+	cache := NewCache(NewMemoryCache(10))
+	//the background request must not share the caller's attempt counter
+	client.Use(LoggingMiddleware(slog.NewJSONHandler(ioutil.Discard, nil), LogOptions{}), cache.Middleware())
+
+	for i := 0; i < 50; i++ {
+		body := ""
+		if _, err := client.Get(&Params{UnmarshalMap: UnmarshalMap{200: &body}}); err != nil || body != "body" {
+			t.Fatal("Wrong response: ", err, body)
+		}
+	}
+}
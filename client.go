@@ -2,6 +2,7 @@ package grestclient
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -10,20 +11,54 @@ import (
 	"net/http"
 	"net/url"
 	rt "reflect"
+	"sync"
+	"time"
 )
 
 //Client lets you maintain query and header across http requests
 //It will let you set (un)marshalers to simplify dealing with
 //json and string responses.
+//
+//A Client is safe for concurrent use and can be configured while requests
+//are being made. Each request takes a snapshot of the client's settings
+//when it starts and isn't affected by changes made after that. The maps
+//returned by Headers and Query are the exception, they are changed in
+//place so use UpdateHeaders and UpdateQuery once the client is shared.
 type Client struct {
+	//mu guards settings. Settings are replaced, never changed in place,
+	//so a snapshot can share them with the client.
+	mu sync.RWMutex
+	settings
+}
+
+//settings holds everything configured on a Client.
+type settings struct {
 	base        *url.URL
 	reqMutators []RequestMutator
 	resMutators []ResponseMutator
 	headers     http.Header
 	query       url.Values
 	client      *http.Client
+	//timeout is set by WithTimeout and timed is client with it applied,
+	//so the two can be set in any order
+	timeout     time.Duration
+	timed       *http.Client
 	marshaler   MarshalerFunc
 	unmarshaler UnmarshalerFunc
+	retry       *RetryPolicy
+
+	successRange *SuccessRange
+	codecs       *CodecRegistry
+
+	streamUnmarshaler StreamUnmarshalerFunc
+	maxBodySize       int64
+	auth              Authenticator
+
+	limiter      *RateLimiter
+	pathLimiters []pathRoute[RateLimiter]
+	breaker      *CircuitBreaker
+	pathBreakers []pathRoute[CircuitBreaker]
+	middleware   []Middleware
 }
 
 //Params represents a parameters you can pass to be used when
@@ -34,6 +69,7 @@ type Params struct {
 	Query   url.Values
 	//Body is ignored by GET, HEAD and other methods that don't typically
 	//have a body
+	//A *Stream is sent as it is read without using the MarshalerFunc.
 	Body         interface{}
 	UnmarshalMap UnmarshalMap
 
@@ -42,11 +78,77 @@ type Params struct {
 	//have been unmarshalled and read. This will make it so that the original
 	//body contents are restored after the unmarshalling
 	Debug bool
+
+	//KeepBodyOpen hands the response body to the caller untouched.
+	//Nothing is unmarshaled and the body is not closed, so the caller
+	//must read and close it. Use it to stream big downloads.
+	KeepBodyOpen bool
+
+	//Context controls the lifetime of the request. It is attached to the
+	//http.Request so RequestMutators can see it through r.Context(), it is
+	//used for the HttpDoer call and it is checked again before the response
+	//body is unmarshaled. If it is canceled or its deadline passes the error
+	//returned satisfies errors.Is(err, ErrCanceled) as well as
+	//errors.Is(err, context.Canceled) or errors.Is(err, context.DeadlineExceeded).
+	//A nil Context is the same as context.Background().
+	Context context.Context
+
+	//fallback gives the destination for status codes missing from
+	//UnmarshalMap. Used by the generic helpers like DoAs.
+	fallback func(status int) interface{}
+}
+
+//destination returns where the body of a response with status
+//should be unmarshaled to, or nil if it shouldn't be.
+func (p *Params) destination(status int) interface{} {
+	if d, ok := p.UnmarshalMap[status]; ok {
+		return d
+	}
+	if p.fallback != nil {
+		return p.fallback(status)
+	}
+	return nil
+}
+
+//withoutUnmarshal returns a copy of p that doesn't unmarshal anything.
+func (p *Params) withoutUnmarshal() *Params {
+	cp := *p
+	cp.UnmarshalMap = nil
+	cp.fallback = nil
+	return &cp
+}
+
+//ErrCanceled is returned, wrapped together with the context's own error,
+//when the Context in Params is canceled or times out before the request
+//is done.
+var ErrCanceled = errors.New("grestclient: request canceled")
+
+//context returns the Context to use for the request, defaulting to
+//context.Background() when none was set.
+func (p *Params) context() context.Context {
+	if p.Context == nil {
+		return context.Background()
+	}
+	return p.Context
+}
+
+//canceled returns an ErrCanceled error if ctx is done. Otherwise
+//err is returned untouched.
+func canceled(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return fmt.Errorf("%w: %w", ErrCanceled, ctxErr)
+	}
+	return err
 }
 
 //Headers returns the default headers that will
 //be set with every request made with the client.
+//They are the client's own map, not a copy. Only change them while
+//setting the client up. Once the client is shared by goroutines changing
+//them is a data race, use UpdateHeaders instead.
 func (c *Client) Headers() http.Header {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	if c.headers == nil {
 		c.headers = make(http.Header)
 	}
@@ -56,11 +158,36 @@ func (c *Client) Headers() http.Header {
 //SetHeaders sets the default headers that will be sent with
 //every request made with this client.
 func (c *Client) SetHeaders(h http.Header) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.headers = h
+}
+
+//UpdateHeaders calls f with a copy of the default headers and makes
+//the copy the new default headers. Requests already started keep
+//the headers they had.
+//
+//	c.UpdateHeaders(func(h http.Header) {
+//		h.Set("Authorization", "Bearer "+token)
+//	})
+func (c *Client) UpdateHeaders(f func(h http.Header)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	h := c.headers.Clone()
+	if h == nil {
+		h = make(http.Header)
+	}
+	f(h)
 	c.headers = h
 }
 
 //Query returns the default query to use for all requests
+//It is the client's own map, not a copy. Only change it while
+//setting the client up. Once the client is shared by goroutines changing
+//it is a data race, use UpdateQuery instead.
 func (c *Client) Query() url.Values {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	if c.query == nil {
 		c.query = make(url.Values)
 	}
@@ -69,9 +196,33 @@ func (c *Client) Query() url.Values {
 
 //SetQuery sets the default query to use for all requests
 func (c *Client) SetQuery(q url.Values) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.query = q
+}
+
+//UpdateQuery calls f with a copy of the default query and makes
+//the copy the new default query. Requests already started keep
+//the query they had.
+func (c *Client) UpdateQuery(f func(q url.Values)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	q := make(url.Values, len(c.query))
+	for k, v := range c.query {
+		q[k] = append([]string(nil), v...)
+	}
+	f(q)
 	c.query = q
 }
 
+//snapshot returns a client with the settings of c at the time of the
+//call. Requests run on a snapshot so they don't need to hold the lock.
+func (c *Client) snapshot() *Client {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return &Client{settings: c.settings}
+}
+
 //SetBaseUrl sets the base url to use for all requests
 //If you want to use a different url temporarily it is best to
 //create a new client with the new base url. Call
@@ -87,12 +238,16 @@ func (c *Client) SetBaseUrl(u *url.URL) error {
 		return errors.New("Please specify a non nil url.")
 	}
 	u.RawQuery = ""
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.base = u
 	return nil
 }
 
 //BaseUrl returns the base url being used.
 func (c *Client) BaseUrl() *url.URL {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 	return c.base
 }
 
@@ -100,21 +255,18 @@ func (c *Client) BaseUrl() *url.URL {
 //However, the http.Client IS shared among clones.
 //All other 'things' like headers, base url, query, marshalers are separate and
 //can be adjusted without affecting the original/clones.
+//With clones the client and changes the clone in one step.
 func (c *Client) Clone() *Client {
-	cc := &Client{}
-	cc.base = cloneUrl(c.base)
+	cc := c.snapshot()
+	cc.base = cloneUrl(cc.base)
 
-	cc.reqMutators = make([]RequestMutator, len(c.reqMutators))
-	copy(cc.reqMutators, c.reqMutators)
+	cc.reqMutators = append([]RequestMutator(nil), cc.reqMutators...)
+	cc.resMutators = append([]ResponseMutator(nil), cc.resMutators...)
 
-	cc.resMutators = make([]ResponseMutator, len(c.resMutators))
-	copy(cc.resMutators, c.resMutators)
-
-	cc.headers = headerCopy(c.headers)
-	cc.query = queryCopy(c.query)
-	cc.client = c.client
-	cc.marshaler = c.marshaler
-	cc.unmarshaler = c.unmarshaler
+	cc.headers = headerCopy(cc.headers)
+	cc.query = queryCopy(cc.query)
+	cc.codecs = cc.codecs.clone()
+	cc.middleware = append([]Middleware(nil), cc.middleware...)
 
 	return cc
 }
@@ -124,7 +276,9 @@ func (c *Client) Clone() *Client {
 //are called AFTER the Marshaler is used.
 //RequestMutators should be called in the order they were added
 func (c *Client) AddRequestMutators(rm ...RequestMutator) *Client {
-	c.reqMutators = append(c.reqMutators, rm...)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.reqMutators = append(c.reqMutators[:len(c.reqMutators):len(c.reqMutators)], rm...)
 	return c
 }
 
@@ -133,29 +287,39 @@ func (c *Client) AddRequestMutators(rm ...RequestMutator) *Client {
 //are called BEFORE the Unmarshaler is used.
 //ResponseMutators should be called in the order they were added
 func (c *Client) AddResponseMutators(rm ...ResponseMutator) *Client {
-	c.resMutators = append(c.resMutators, rm...)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.resMutators = append(c.resMutators[:len(c.resMutators):len(c.resMutators)], rm...)
 	return c
 }
 
 //SetRequestMutators removes a request mutator
 func (c *Client) SetRequestMutators(rm ...RequestMutator) *Client {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.reqMutators = rm
 	return c
 }
 
 //SetResponseMutators removes a response mutator
 func (c *Client) SetResponseMutators(rm ...ResponseMutator) *Client {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.resMutators = rm
 	return c
 }
 
 //Returns the RequestMutators
 func (c *Client) RequestMutators() []RequestMutator {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 	return c.reqMutators
 }
 
 //Returns the ResponseMutators
 func (c *Client) ResponseMutators() []ResponseMutator {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 	return c.resMutators
 }
 
@@ -167,11 +331,7 @@ func (c *Client) ResponseMutators() []ResponseMutator {
 //The returned http.Response might be non-nil even though an error was also returned
 //depending on where the operation failed.
 func (c *Client) Get(req *Params) (*http.Response, error) {
-	r, err := c.prepareRequest("GET", req.Path, req.Headers, req.Query, nil)
-	if err != nil {
-		return nil, err
-	}
-	return c.do(r, req)
+	return c.Do("GET", req)
 }
 
 //Post performs a post request with the base url plus the path appended to it.
@@ -183,11 +343,7 @@ func (c *Client) Get(req *Params) (*http.Response, error) {
 //The returned http.Response might be non-nil even though an error was also returned
 //depending on where the operation failed.
 func (c *Client) Post(req *Params) (*http.Response, error) {
-	r, err := c.prepareRequest("POST", req.Path, req.Headers, req.Query, req.Body)
-	if err != nil {
-		return nil, err
-	}
-	return c.do(r, req)
+	return c.Do("POST", req)
 }
 
 //Put performs a put request with the base url plus the path appended to it.
@@ -199,11 +355,7 @@ func (c *Client) Post(req *Params) (*http.Response, error) {
 //The returned http.Response might be non-nil even though an error was also returned
 //depending on where the operation failed.
 func (c *Client) Put(req *Params) (*http.Response, error) {
-	r, err := c.prepareRequest("PUT", req.Path, req.Headers, req.Query, req.Body)
-	if err != nil {
-		return nil, err
-	}
-	return c.do(r, req)
+	return c.Do("PUT", req)
 }
 
 //Patch performs a patch request with the base url plus the path appended to it.
@@ -215,11 +367,7 @@ func (c *Client) Put(req *Params) (*http.Response, error) {
 //The returned http.Response might be non-nil even though an error was also returned
 //depending on where the operation failed.
 func (c *Client) Patch(req *Params) (*http.Response, error) {
-	r, err := c.prepareRequest("PATCH", req.Path, req.Headers, req.Query, req.Body)
-	if err != nil {
-		return nil, err
-	}
-	return c.do(r, req)
+	return c.Do("PATCH", req)
 }
 
 //Head performs a head request with the base url plus the path appended to it.
@@ -230,12 +378,7 @@ func (c *Client) Patch(req *Params) (*http.Response, error) {
 //The returned http.Response might be non-nil even though an error was also returned
 //depending on where the operation failed.
 func (c *Client) Head(req *Params) (*http.Response, error) {
-	r, err := c.prepareRequest("HEAD", req.Path, req.Headers, req.Query, nil)
-	if err != nil {
-		return nil, err
-	}
-	req.UnmarshalMap = nil
-	return c.do(r, req)
+	return c.Do("HEAD", req)
 }
 
 //Option performs an option request with the base url plus the path appended to it.
@@ -246,11 +389,7 @@ func (c *Client) Head(req *Params) (*http.Response, error) {
 //The returned http.Response might be non-nil even though an error was also returned
 //depending on where the operation failed.
 func (c *Client) Options(req *Params) (*http.Response, error) {
-	r, err := c.prepareRequest("OPTIONS", req.Path, req.Headers, req.Query, req.Body)
-	if err != nil {
-		return nil, err
-	}
-	return c.do(r, req)
+	return c.Do("OPTIONS", req)
 }
 
 //Delete performs an delete request with the base url plus the path appended to it.
@@ -261,11 +400,80 @@ func (c *Client) Options(req *Params) (*http.Response, error) {
 //The returned http.Response might be non-nil even though an error was also returned
 //depending on where the operation failed.
 func (c *Client) Delete(req *Params) (*http.Response, error) {
-	r, err := c.prepareRequest("DELETE", req.Path, req.Headers, req.Query, req.Body)
+	return c.Do("DELETE", req)
+}
+
+//Do performs a request with any HTTP method, for example WebDAV's
+//PROPFIND or MKCOL, with the base url plus the path appended to it.
+//It goes through the same header/query merging, marshaling, mutators
+//and unmarshaling as Get, Post and the rest, which are just Do with the
+//method filled in.
+//The body is ignored for GET and HEAD and nothing is unmarshaled for HEAD.
+//Returns the raw http.Response and error similar to Do method of http.Client
+//The returned http.Response might be non-nil even though an error was also returned
+//depending on where the operation failed.
+func (c *Client) Do(method string, req *Params) (*http.Response, error) {
+	var body interface{}
+	switch method {
+	case "GET":
+	case "HEAD":
+		req = req.withoutUnmarshal()
+	default:
+		body = req.Body
+	}
+
+	s := c.snapshot()
+	r, err := s.prepareRequest(req.context(), method, req.Path, req.Headers, req.Query, body)
 	if err != nil {
 		return nil, err
 	}
-	return c.do(r, req)
+	return s.do(r, req)
+}
+
+//Send performs a request you built yourself. If the request's url has no
+//host then it is treated as a path relative to the base url. Otherwise it
+//is used as is.
+//The client's default headers and query are merged in underneath the
+//request's own, and the Headers and Query in req override both.
+//req.Body is marshaled only if the request doesn't already have a body.
+//req.Path is ignored and req may be nil.
+//The request is cloned before being changed so the one passed in can be reused.
+func (c *Client) Send(r *http.Request, req *Params) (*http.Response, error) {
+	if r == nil {
+		return nil, errors.New("Please specify a non nil request.")
+	}
+	if req == nil {
+		req = &Params{}
+	}
+
+	ctx := r.Context()
+	if req.Context != nil {
+		ctx = req.Context
+	}
+	r = r.Clone(ctx)
+
+	s := c.snapshot()
+	if r.URL.Host == "" {
+		reqUrl := cloneUrl(s.base)
+		reqUrl.Path += r.URL.Path
+		reqUrl.RawQuery = r.URL.RawQuery
+		r.URL = reqUrl
+		r.Host = reqUrl.Host
+	}
+
+	var body interface{}
+	if r.Body == nil || r.Body == http.NoBody {
+		body = req.Body
+	}
+
+	if err := s.setupRequest(r, req.Headers, req.Query, body); err != nil {
+		return nil, err
+	}
+
+	if r.Method == "HEAD" {
+		req = req.withoutUnmarshal()
+	}
+	return s.do(r, req)
 }
 
 //UnmarshalMap represents a mapping from HTTP status
@@ -399,141 +607,227 @@ type ResponseMutator func(*http.Response) error
 
 //SetupClientForJson is a convenience method that sets the
 //marshaler and unmarshaler funcs on the client to be the
-//Json funcs in this package. It also sets a request mutator
-//to set the Content-Type to json.
+//Json funcs in this package. It also sets the default
+//Content-Type and Accept headers to json. Default headers, unlike
+//RequestMutators, are in place when the marshaler is picked, so a
+//codec registered for json in Codecs is used as well.
 func SetupForJson(c *Client) {
 	c.SetMarshaler(JsonMarshalerFunc)
 	c.SetUnmarshaler(JsonUnmarshalerFunc)
-	c.AddRequestMutators(JsonContentTypeMutator)
-	c.AddRequestMutators(JsonAcceptMutator)
+	setDefaultHeaders(c, "application/json", "application/json")
+}
+
+//setDefaultHeaders sets the default Content-Type and, if accept isn't
+//empty, the default Accept header.
+func setDefaultHeaders(c *Client, contentType string, accept string) {
+	c.UpdateHeaders(func(h http.Header) {
+		h.Set("Content-Type", contentType)
+		if accept != "" {
+			h.Set("Accept", accept)
+		}
+	})
 }
 
 func (c *Client) do(r *http.Request, params *Params) (*http.Response, error) {
 
-	unmarshalMap := params.UnmarshalMap
+	ctx := r.Context()
+	r, attempts := countAttempts(c.withRequestInfo(r))
 
-	var err error
-	if c.RequestMutators() != nil {
-		for _, m := range c.RequestMutators() {
-			err = m(r)
-			if err != nil {
-				return nil, err
-			}
+	response, err := c.handler()(r, params)
+	if response == nil {
+		if err == nil {
+			err = errNoResponse
 		}
-	}
-	var response *http.Response
-	client := c.GetHttpDoer()
-
-	response, err = client.Do(r)
-
-	if err != nil {
 		return nil, err
 	}
-	defer response.Body.Close()
-
-	if c.ResponseMutators() != nil {
-		var err error
-		for _, m := range c.ResponseMutators() {
-			err = m(response)
-			if err != nil {
-				return response, err
-			}
-		}
+	if !params.KeepBodyOpen {
+		defer response.Body.Close()
 	}
-
-	if c.unmarshaler == nil {
-		c.unmarshaler = StringUnmarshalerFunc
+	if err != nil {
+		return response, err
 	}
 
-	if unmarshalMap != nil {
+	var body []byte
+	var read bool
+	var payload interface{}
+	if (params.UnmarshalMap != nil || params.fallback != nil) && !params.KeepBodyOpen {
 		//make sure there is a body, or that there might be a body (when it is -1)
 		if response.ContentLength > 0 || response.ContentLength == -1 {
 			//unmarshal it depending on StatusCode
-			if destination, ok := unmarshalMap[response.StatusCode]; ok && destination != nil {
-				body, err := ioutil.ReadAll(response.Body)
-
-				//we're debugging so add the body back to the response
-				if params.Debug {
-					r, _ := ByteSliceToReadLener(body)
-					response.Body = ioutil.NopCloser(r)
-				}
-
+			if destination := params.destination(response.StatusCode); destination != nil {
+				read = true
+				contentType := response.Header.Get("Content-Type")
+				var reader io.Reader
+				reader, err = c.limitBody(response)
 				if err != nil {
 					return response, err
 				}
-				err = c.unmarshaler(body, destination)
+
+				if stream := c.streamUnmarshalerFor(contentType); stream != nil && !params.Debug {
+					//keep a snapshot of the body for the HTTPError
+					var snapshot *snapshotWriter
+					if c.successRange != nil && !c.successRange.Contains(response.StatusCode) {
+						snapshot = &snapshotWriter{limit: ErrorBodySnapshotSize}
+						reader = io.TeeReader(reader, snapshot)
+					}
+					err = stream(reader, destination)
+					if ctxErr := canceled(ctx, nil); ctxErr != nil {
+						return response, ctxErr
+					}
+					if snapshot != nil {
+						//the decoder may stop before the end of the body
+						io.Copy(ioutil.Discard, io.LimitReader(reader, snapshot.room()))
+						body = snapshot.buf.Bytes()
+					}
+				} else {
+					body, err = ioutil.ReadAll(reader)
+
+					//we're debugging so add the body back to the response
+					if params.Debug {
+						r, _ := ByteSliceToReadLener(body)
+						response.Body = ioutil.NopCloser(r)
+					}
+
+					if err != nil {
+						return response, canceled(ctx, err)
+					}
+					if err = canceled(ctx, nil); err != nil {
+						return response, err
+					}
+					unmarshaler := c.unmarshalerFor(contentType)
+					err = unmarshaler(body, destination)
+				}
+				if err == nil {
+					payload = destination
+				}
 			}
 		}
 	}
 
+	if c.successRange != nil && !c.successRange.Contains(response.StatusCode) {
+		if !read && r.Method != "HEAD" && !params.KeepBodyOpen {
+			if params.Debug {
+				body, _ = ioutil.ReadAll(response.Body)
+				r, _ := ByteSliceToReadLener(body)
+				response.Body = ioutil.NopCloser(r)
+			} else {
+				body, _ = ioutil.ReadAll(io.LimitReader(response.Body, ErrorBodySnapshotSize))
+			}
+		}
+		err = newHTTPError(r, response, body, payload)
+		if c.gaveUp(*attempts, response) {
+			err = &RetryError{Attempts: *attempts, Err: err}
+		}
+		return response, err
+	}
+
 	if err != nil {
 		//we have the http response so return it even though unmarshaling might've
 		//produced an error
 		return response, err
 	}
 
+	if c.gaveUp(*attempts, response) {
+		return response, &RetryError{Attempts: *attempts, Err: newHTTPError(r, response, body, payload)}
+	}
 	return response, nil
 }
 
 func (c *Client) prepareRequest(
+	ctx context.Context,
 	method string,
 	path string,
 	headers http.Header,
 	query url.Values,
 	body interface{}) (*http.Request, error) {
 
-	var err error
 	reqUrl := cloneUrl(c.base)
 	reqUrl.Path += path
+	reqUrl.RawQuery = ""
 
-	//set headers
-	headers = setupHeaders(c.headers, headers)
-	//create query
-	query = setupQuery(c.query, query)
-
-	if c.marshaler == nil {
-		c.marshaler = StringMarshalerFunc
+	r, err := http.NewRequestWithContext(ctx, method, reqUrl.String(), nil)
+	if err != nil {
+		return nil, err
 	}
 
-	r, err := http.NewRequest(method, reqUrl.String(), nil)
-	if err != nil {
+	if err = c.setupRequest(r, headers, query, body); err != nil {
 		return nil, err
 	}
 
-	r.Header = headers
-	r.URL.RawQuery = query.Encode()
+	return r, nil
+}
+
+//setupRequest merges the default headers and query into r, underneath
+//what r already has, then applies headers and query on top.
+//If body is not nil it is marshaled into r.Body, unless it is a *Stream
+//which is sent without being marshaled.
+func (c *Client) setupRequest(
+	r *http.Request,
+	headers http.Header,
+	query url.Values,
+	body interface{}) error {
+
+	var err error
+
+	//set headers
+	r.Header = setupHeaders(c.headers, r.Header, headers)
+	//create query
+	r.URL.RawQuery = setupQuery(c.query, r.URL.Query(), query).Encode()
+
+	if s, ok := body.(*Stream); ok {
+		return s.setup(r)
+	}
 
 	var readLener ReadLener
 	if body != nil {
 
-		readLener, err = c.marshaler(body)
+		marshaler := c.marshalerFor(r.Header.Get("Content-Type"))
+		readLener, err = marshaler(body)
 
 		if err != nil {
-			return nil, err
+			return err
 		}
 		r.ContentLength = int64(readLener.Len())
-		r.Body = ioutil.NopCloser(readLener)
+		if ct, ok := readLener.(ContentTyper); ok {
+			r.Header.Set("Content-Type", ct.ContentType())
+		}
+
+		//keep the marshaled bytes so the body can be sent again
+		//when the request is retried or redirected
+		var b []byte
+		b, err = ioutil.ReadAll(readLener)
+		if err != nil {
+			return err
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(b))
+		r.GetBody = func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(b)), nil
+		}
 	}
 
-	return r, nil
+	return nil
 }
 
+//setupHeaders merges headers into a new http.Header, later ones winning.
+//The values are copied so mutators adding to a request's headers can't
+//write into the client's defaults shared by other requests.
 func setupHeaders(headers ...http.Header) http.Header {
 	finalheaders := make(http.Header)
 	for _, current := range headers {
 		for i, v := range current {
-			finalheaders[i] = v
+			finalheaders[i] = append([]string(nil), v...)
 		}
 	}
 
 	return finalheaders
 }
 
+//setupQuery merges queries like setupHeaders does headers.
 func setupQuery(queries ...url.Values) url.Values {
 	finalquery := make(url.Values)
 	for _, current := range queries {
 		for i, v := range current {
-			finalquery[i] = v
+			finalquery[i] = append([]string(nil), v...)
 		}
 	}
 
@@ -546,7 +840,7 @@ func headerCopy(h http.Header) http.Header {
 	}
 	c := make(http.Header, len(h))
 	for i, v := range h {
-		c[i] = v
+		c[i] = append([]string(nil), v...)
 	}
 	return c
 }
@@ -557,7 +851,7 @@ func queryCopy(q url.Values) url.Values {
 	}
 	c := make(url.Values, len(q))
 	for i, v := range q {
-		c[i] = v
+		c[i] = append([]string(nil), v...)
 	}
 	return c
 }
@@ -565,42 +859,85 @@ func queryCopy(q url.Values) url.Values {
 //GetHttpClient returns the current http.Client being used
 //If none has been set, this will return a http.DefaultClient
 func (c *Client) GetHttpDoer() HttpDoer {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.httpDoer()
+}
+
+func (c *Client) httpDoer() HttpDoer {
+	if c.timed != nil {
+		return c.timed
+	}
 	if c.client == nil {
-		c.client = http.DefaultClient
+		return http.DefaultClient
 	}
 	return c.client
 }
 
+//applyTimeout sets timed to a copy of the http.Client, or of a new one if
+//there is none, with the timeout set. c.mu must be held.
+func (c *Client) applyTimeout() {
+	c.timed = nil
+	if c.timeout <= 0 {
+		return
+	}
+	h := &http.Client{}
+	if c.client != nil {
+		*h = *c.client
+	}
+	h.Timeout = c.timeout
+	c.timed = h
+}
+
 type HttpDoer interface {
 	Do(r *http.Request) (*http.Response, error)
 }
 
 //SetHttpClient sets the http.Client to use during requests
 //Use this to customize your http.Client as you wish. If you
-//don't set one, the default http.Client will be used.
+//don't set one, the default http.Client will be used. A timeout set
+//with WithTimeout is applied to a copy of h.
 func (c *Client) SetHttpDoer(h *http.Client) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.client = h
+	c.applyTimeout()
 }
 
 //SetMarshaler sets the marshal function to be used
 //to marshal the request bodies for requests
 //Doesn't have to mirror the Unmarshaler. Send plain text, get back json
-//Default is a json marshaler
+//Default is a string marshaler. A codec registered in Codecs for the
+//request's Content-Type is used instead when there is one. That is the
+//Content-Type in the default headers or Params.Headers, not one set by a
+//RequestMutator since those run after the body is marshaled.
 func (c *Client) SetMarshaler(f MarshalerFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.marshaler = f
 }
 
 //SetUnmarshaler sets the unmarshal function to be used
 //to unmarshal the response body for responses
 //Doesn't have to mirror the Marshaler. Send XML, get back json
-//Default is a json unmarshaler
+//Default is a string unmarshaler. A codec registered in Codecs for the
+//response's Content-Type is used instead when there is one.
 func (c *Client) SetUnmarshaler(f UnmarshalerFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.unmarshaler = f
 }
 
 //New creates a new grestclient with the base url set
-//to the passed in paramater.
-func New(base *url.URL) (*Client, error) {
+//to the passed in paramater and opts applied in order.
+//
+//	c, err := New(base,
+//		WithJson(),
+//		WithHeaders(http.Header{"X-Api-Key": {key}}),
+//		WithTimeout(10*time.Second),
+//		WithRetry(&RetryPolicy{MaxAttempts: 3}),
+//	)
+func New(base *url.URL, opts ...Option) (*Client, error) {
 
 	if base == nil {
 		return nil, errors.New("Please specify a non nil url.")
@@ -608,6 +945,9 @@ func New(base *url.URL) (*Client, error) {
 	c := &Client{}
 	c.base = base
 
+	if err := c.apply(opts); err != nil {
+		return nil, err
+	}
 	return c, nil
 }
 
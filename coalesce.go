@@ -0,0 +1,141 @@
+package grestclient
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+//DefaultCoalesceHeaders are the request headers telling identical
+//requests apart when CoalescingMiddleware is given none.
+var DefaultCoalesceHeaders = []string{"Accept", "Accept-Language", "Authorization"}
+
+//coalescedCall is a round trip shared by identical requests.
+type coalescedCall struct {
+	done     chan struct{}
+	response *http.Response
+	body     []byte
+	err      error
+	attempts int
+
+	//waiters is the number of callers waiting, guarded by the mutex of
+	//the middleware
+	waiters int
+	cancel  context.CancelFunc
+}
+
+//CoalescingMiddleware lets identical GET and HEAD requests made at the
+//same time share one round trip. Requests are identical when their
+//method, URL including the query and the values of headers, or of the
+//DefaultCoalesceHeaders if none are given, are the same. The first request
+//is sent and the ones coming in while it is in flight wait for its
+//response. Each of them gets a copy of it with its own body, so every
+//caller's UnmarshalMap is filled in.
+//
+//The body of the shared response is read into memory. Requests with
+//KeepBodyOpen set, which may stream their body, are never coalesced.
+//Requests are authenticated after Middleware runs, so every request
+//coalesced gets the same credentials; add a separate CoalescingMiddleware
+//to each client.
+//
+//The round trip keeps the values and deadline of the request that started
+//it, but goes on if that request is canceled. A canceled caller stops
+//waiting with an ErrCanceled error, and the round trip is canceled once
+//no caller is waiting for it.
+func CoalescingMiddleware(headers ...string) Middleware {
+	if len(headers) == 0 {
+		headers = DefaultCoalesceHeaders
+	}
+	headers = append([]string(nil), headers...)
+	sort.Strings(headers)
+	var mu sync.Mutex
+	calls := make(map[string]*coalescedCall)
+
+	return func(next Handler) Handler {
+		return func(r *http.Request, p *Params) (*http.Response, error) {
+			if (r.Method != "GET" && r.Method != "HEAD") || p.KeepBodyOpen ||
+				(r.Body != nil && r.Body != http.NoBody) {
+				return next(r, p)
+			}
+
+			key := coalesceKey(r, headers)
+			mu.Lock()
+			call, ok := calls[key]
+			if !ok {
+				ctx, cancel := detach(r.Context())
+				call = &coalescedCall{done: make(chan struct{}), cancel: cancel}
+				calls[key] = call
+
+				go func() {
+					defer func() {
+						mu.Lock()
+						if calls[key] == call {
+							delete(calls, key)
+						}
+						mu.Unlock()
+						call.cancel()
+						close(call.done)
+					}()
+					shared := r.WithContext(ctx)
+					call.response, call.err = next(shared, p)
+					if call.response != nil {
+						body, err := ioutil.ReadAll(call.response.Body)
+						call.response.Body.Close()
+						if err != nil && call.err == nil {
+							call.err = err
+						}
+						call.body = body
+					}
+					_, attempts := countAttempts(shared)
+					call.attempts = *attempts
+				}()
+			}
+			call.waiters++
+			mu.Unlock()
+
+			select {
+			case <-call.done:
+			case <-r.Context().Done():
+				mu.Lock()
+				if call.waiters--; call.waiters == 0 {
+					//nobody wants the response anymore, identical requests
+					//coming in start over
+					if calls[key] == call {
+						delete(calls, key)
+					}
+					call.cancel()
+				}
+				mu.Unlock()
+				return nil, canceled(r.Context(), nil)
+			}
+			setAttempts(r.Context(), call.attempts)
+			if call.response == nil {
+				return nil, call.err
+			}
+			response := *call.response
+			response.Header = call.response.Header.Clone()
+			response.Body = ioutil.NopCloser(bytes.NewReader(call.body))
+			response.Request = r
+			return &response, call.err
+		}
+	}
+}
+
+//coalesceKey returns the key requests are coalesced on.
+func coalesceKey(r *http.Request, headers []string) string {
+	var key strings.Builder
+	key.WriteString(r.Method)
+	key.WriteString(" ")
+	key.WriteString(r.URL.String())
+	for _, name := range headers {
+		key.WriteString("\n")
+		key.WriteString(http.CanonicalHeaderKey(name))
+		key.WriteString(": ")
+		key.WriteString(strings.Join(r.Header.Values(name), ", "))
+	}
+	return key.String()
+}
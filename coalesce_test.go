@@ -0,0 +1,185 @@
+package grestclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCoalescingMiddleware(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"name":"%s"}`, req.URL.Query().Get("name"))
+	}))
+	defer server.Close()
+
+	base, _ := url.Parse(server.URL)
+	client, _ := New(base)
+	client.SetHttpDoer(http.DefaultClient)
+	client.SetCodecs(DefaultCodecs())
+
+	//counts the requests that got as far as the coalescing
+	var entered int32
+	client.Use(func(next Handler) Handler {
+		return func(r *http.Request, p *Params) (*http.Response, error) {
+			atomic.AddInt32(&entered, 1)
+			return next(r, p)
+		}
+	})
+	client.Use(CoalescingMiddleware())
+
+	const n = 10
+	things := make([]genericThing, n)
+	statuses := make([]int, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			res, err := client.Get(&Params{
+				Path:         "thing",
+				Query:        url.Values{"name": {"shared"}},
+				UnmarshalMap: UnmarshalMap{200: &things[i]},
+			})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			statuses[i] = res.StatusCode
+		}(i)
+	}
+	for atomic.LoadInt32(&entered) < n {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls != 1 {
+		t.Fatal("Identical requests should share one round trip: ", calls)
+	}
+	for i := range things {
+		if things[i].Name != "shared" || statuses[i] != 200 {
+			t.Fatal("Every caller should get the response: ", i, things[i], statuses[i])
+		}
+	}
+
+	//different queries or headers are not coalesced
+	client.Get(&Params{Path: "thing", Query: url.Values{"name": {"a"}}})
+	client.Get(&Params{Path: "thing", Query: url.Values{"name": {"a"}}, Headers: http.Header{"Accept": {"text/plain"}}})
+	client.Post(&Params{Path: "thing"})
+	if calls != 4 {
+		t.Fatal("Requests should not have been coalesced: ", calls)
+	}
+}
+
+func TestCoalescingMiddlewareCanceledCaller(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		<-release
+		fmt.Fprint(w, "done")
+	}))
+	defer server.Close()
+
+	base, _ := url.Parse(server.URL)
+	client, _ := New(base)
+	client.SetHttpDoer(http.DefaultClient)
+	//the shared round trip must not share the canceled caller's attempt counter
+	client.Use(LoggingMiddleware(slog.NewJSONHandler(ioutil.Discard, nil), LogOptions{}), CoalescingMiddleware("X-Tenant"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, err := client.Get(&Params{Context: ctx})
+		first <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	second := make(chan string, 1)
+	go func() {
+		body := ""
+		client.Get(&Params{UnmarshalMap: UnmarshalMap{200: &body}})
+		second <- body
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	cancel()
+	if err := <-first; !errors.Is(err, ErrCanceled) {
+		t.Fatal("Canceled caller should stop waiting: ", err)
+	}
+	close(release)
+	if body := <-second; body != "done" {
+		t.Fatal("Shared round trip should go on for the other callers: ", body)
+	}
+}
+
+type coalesceTestKey struct{}
+
+func TestCoalescingMiddlewareKeepsContext(t *testing.T) {
+	gone := make(chan struct{}, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		//hangs until the client gives up
+		select {
+		case <-req.Context().Done():
+			gone <- struct{}{}
+		case <-time.After(10 * time.Second):
+		}
+	}))
+	defer server.Close()
+
+	base, _ := url.Parse(server.URL)
+	client, _ := New(base)
+	client.SetHttpDoer(&http.Client{})
+	var value interface{}
+	client.Use(CoalescingMiddleware(), func(next Handler) Handler {
+		return func(r *http.Request, p *Params) (*http.Response, error) {
+			value = r.Context().Value(coalesceTestKey{})
+			return next(r, p)
+		}
+	})
+
+	//the deadline of the first caller ends the shared round trip
+	ctx, cancel := context.WithTimeout(context.WithValue(context.Background(), coalesceTestKey{}, "trace"), 50*time.Millisecond)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		_, err := client.Get(&Params{Context: ctx})
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("Expected the request to time out.")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("The shared round trip should have kept the deadline.")
+	}
+	if value != "trace" {
+		t.Fatal("Context values should be kept: ", value)
+	}
+	<-gone
+
+	//once every caller is gone the round trip is canceled
+	ctx, cancel = context.WithCancel(context.Background())
+	go client.Get(&Params{Context: ctx})
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	select {
+	case <-gone:
+	case <-time.After(5 * time.Second):
+		t.Fatal("The shared round trip should have been canceled.")
+	}
+}
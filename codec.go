@@ -0,0 +1,174 @@
+package grestclient
+
+import (
+	"mime"
+	"strings"
+	"sync"
+)
+
+//Codec pairs the MarshalerFunc and UnmarshalerFunc used for a media type.
+//Either one can be nil if the codec only works in one direction.
+type Codec struct {
+	Marshaler   MarshalerFunc
+	Unmarshaler UnmarshalerFunc
+}
+
+//CodecRegistry maps media types to Codecs. The client uses it to pick
+//the marshaler from the request's Content-Type and the unmarshaler from
+//the response's Content-Type.
+//
+//Media types are looked up in this order, stopping at the first codec
+//that has the func needed:
+//
+//	application/problem+json  the exact type, parameters are ignored
+//	application/json          the structured syntax suffix, for +json, +xml and the like
+//	application/*             the wildcard subtype
+//	*/*                       the catch all
+//
+//The client's own marshaler and unmarshaler are used when nothing matches.
+//
+//The marshaler is picked from the Content-Type in the client's default
+//headers and Params.Headers. RequestMutators run after the body is
+//marshaled, so a Content-Type set by one, like JsonContentTypeMutator,
+//doesn't pick a codec. The SetupFor helpers set a default header instead.
+//
+//A registry can be changed while clients are using it.
+type CodecRegistry struct {
+	mu     sync.RWMutex
+	codecs map[string]Codec
+}
+
+//NewCodecRegistry returns an empty registry.
+func NewCodecRegistry() *CodecRegistry {
+	return &CodecRegistry{codecs: make(map[string]Codec)}
+}
+
+//DefaultCodecs returns a registry with the codecs in this package
+//registered for json, xml, url encoded and multipart forms, the
+//length-delimited binary format and text.
+func DefaultCodecs() *CodecRegistry {
+	return NewCodecRegistry().
+		Register("application/json", Codec{JsonMarshalerFunc, JsonUnmarshalerFunc}).
+		Register("application/xml", Codec{XmlMarshalerFunc, XmlUnmarshalerFunc}).
+		Register("text/xml", Codec{XmlMarshalerFunc, XmlUnmarshalerFunc}).
+		Register(FormContentType, Codec{FormMarshalerFunc, FormUnmarshalerFunc}).
+		Register("multipart/form-data", Codec{MultipartMarshalerFunc, MultipartUnmarshalerFunc}).
+		Register("multipart/mixed", Codec{MultipartMarshalerFunc, MultipartUnmarshalerFunc}).
+		Register(DelimitedContentType, Codec{DelimitedMarshalerFunc, DelimitedUnmarshalerFunc}).
+		Register("text/*", Codec{StringMarshalerFunc, StringUnmarshalerFunc})
+}
+
+//Register sets the codec to use for mediaType which can be a full type,
+//a wildcard like text/* or */*.
+func (r *CodecRegistry) Register(mediaType string, codec Codec) *CodecRegistry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.codecs[strings.ToLower(mediaType)] = codec
+	return r
+}
+
+//Remove removes the codec registered for mediaType.
+func (r *CodecRegistry) Remove(mediaType string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.codecs, strings.ToLower(mediaType))
+}
+
+//Marshaler returns the MarshalerFunc for the Content-Type contentType.
+func (r *CodecRegistry) Marshaler(contentType string) (MarshalerFunc, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, t := range candidates(contentType) {
+		if codec, ok := r.codecs[t]; ok && codec.Marshaler != nil {
+			return codec.Marshaler, true
+		}
+	}
+	return nil, false
+}
+
+//Unmarshaler returns the UnmarshalerFunc for the Content-Type contentType.
+func (r *CodecRegistry) Unmarshaler(contentType string) (UnmarshalerFunc, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, t := range candidates(contentType) {
+		if codec, ok := r.codecs[t]; ok && codec.Unmarshaler != nil {
+			return codec.Unmarshaler, true
+		}
+	}
+	return nil, false
+}
+
+func (r *CodecRegistry) clone() *CodecRegistry {
+	if r == nil {
+		return nil
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	cr := NewCodecRegistry()
+	for t, codec := range r.codecs {
+		cr.codecs[t] = codec
+	}
+	return cr
+}
+
+//candidates lists the registry keys to try for contentType, most
+//specific first. An empty or unparsable contentType only matches */*.
+func candidates(contentType string) []string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || !strings.Contains(mediaType, "/") {
+		return []string{"*/*"}
+	}
+	list := []string{mediaType}
+
+	slash := strings.Index(mediaType, "/")
+	main, sub := mediaType[:slash], mediaType[slash+1:]
+	if plus := strings.LastIndex(sub, "+"); plus >= 0 {
+		list = append(list, "application/"+sub[plus+1:])
+	}
+	return append(list, main+"/*", "*/*")
+}
+
+//Codecs returns the client's codec registry.
+func (c *Client) Codecs() *CodecRegistry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.codecs == nil {
+		c.codecs = NewCodecRegistry()
+	}
+	return c.codecs
+}
+
+//SetCodecs sets the codec registry the client uses.
+func (c *Client) SetCodecs(r *CodecRegistry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.codecs = r
+}
+
+//marshalerFor returns the MarshalerFunc for a request body with the
+//Content-Type contentType.
+func (c *Client) marshalerFor(contentType string) MarshalerFunc {
+	if c.codecs != nil {
+		if m, ok := c.codecs.Marshaler(contentType); ok {
+			return m
+		}
+	}
+	if c.marshaler == nil {
+		return StringMarshalerFunc
+	}
+	return c.marshaler
+}
+
+//unmarshalerFor returns the UnmarshalerFunc for a response body with the
+//Content-Type contentType.
+func (c *Client) unmarshalerFor(contentType string) UnmarshalerFunc {
+	if c.codecs != nil {
+		if u, ok := c.codecs.Unmarshaler(contentType); ok {
+			return u
+		}
+	}
+	if c.unmarshaler == nil {
+		return StringUnmarshalerFunc
+	}
+	return c.unmarshaler
+}
@@ -0,0 +1,144 @@
+package grestclient
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestCodecCandidates(t *testing.T) {
+	r := NewCodecRegistry()
+	r.Register("application/json", Codec{Unmarshaler: JsonUnmarshalerFunc})
+	r.Register("text/*", Codec{Unmarshaler: StringUnmarshalerFunc})
+
+	if _, ok := r.Unmarshaler("application/problem+json; charset=utf-8"); !ok {
+		t.Fatal("Expected +json to fall back to application/json.")
+	}
+	if _, ok := r.Unmarshaler("text/html"); !ok {
+		t.Fatal("Expected text/html to match text/*.")
+	}
+	if _, ok := r.Unmarshaler("image/png"); ok {
+		t.Fatal("Did not expect image/png to match.")
+	}
+	if _, ok := r.Marshaler("application/json"); ok {
+		t.Fatal("Did not expect a marshaler for a codec without one.")
+	}
+
+	r.Register("*/*", Codec{Marshaler: StringMarshalerFunc})
+	if _, ok := r.Marshaler(""); !ok {
+		t.Fatal("Expected an empty Content-Type to match */*.")
+	}
+}
+
+func TestUnmarshalerChosenByContentType(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/ok" {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"name":"thing"}`))
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.WriteHeader(http.StatusBadGateway)
+		w.Write([]byte("<h1>bad gateway</h1>"))
+	}))
+	defer server.Close()
+
+	base, err := url.Parse(server.URL)
+	client, err := New(base)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Codecs().
+		Register("application/json", Codec{JsonMarshalerFunc, JsonUnmarshalerFunc}).
+		Register("text/*", Codec{StringMarshalerFunc, StringUnmarshalerFunc})
+
+	var success genericThing
+	var fail string
+	params := &Params{
+		Path:         "ok",
+		UnmarshalMap: UnmarshalMap{200: &success, http.StatusBadGateway: &fail},
+	}
+
+	if _, err = client.Get(params); err != nil {
+		t.Fatal(err)
+	}
+	if success.Name != "thing" {
+		t.Fatal("Json response was not decoded: ", success)
+	}
+
+	params.Path = "bad"
+	if _, err = client.Get(params); err != nil {
+		t.Fatal(err)
+	}
+	if fail != "<h1>bad gateway</h1>" {
+		t.Fatal("Html response was not decoded as text: ", fail)
+	}
+}
+
+func TestMarshalerChosenByContentType(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		b, _ := ioutil.ReadAll(req.Body)
+		if string(b) != `{"name":"thing"}` {
+			t.Fatal("Body was not marshaled as json: ", string(b))
+		}
+	}))
+	defer server.Close()
+
+	base, err := url.Parse(server.URL)
+	client, err := New(base)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Codecs().Register("application/json", Codec{Marshaler: JsonMarshalerFunc})
+
+	_, err = client.Post(&Params{
+		Path:    "post",
+		Headers: http.Header{"Content-Type": []string{"application/json"}},
+		Body:    genericThing{Name: "thing"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMarshalerChosenByContentTypeOfSetup(t *testing.T) {
+	var body, contentType string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		b, _ := ioutil.ReadAll(req.Body)
+		body, contentType = string(b), req.Header.Get("Content-Type")
+	}))
+	defer server.Close()
+
+	base, _ := url.Parse(server.URL)
+	client, _ := New(base)
+	client.Codecs().Register("application/json", Codec{Marshaler: func(v interface{}) (ReadLener, error) {
+		return StringToReadLener("from codec"), nil
+	}})
+
+	//a Content-Type set by a RequestMutator comes too late to pick the
+	//marshaler, the client's own is used
+	client.SetMarshaler(JsonMarshalerFunc)
+	client.AddRequestMutators(JsonContentTypeMutator)
+	client.Post(&Params{Body: genericThing{Name: "thing"}})
+	if body != `{"name":"thing"}` || contentType != "application/json" {
+		t.Fatal("Mutator's Content-Type should not pick the codec: ", body, contentType)
+	}
+
+	//SetupForJson sets a default header, which does pick it
+	client.SetRequestMutators()
+	SetupForJson(client)
+	client.Post(&Params{Body: genericThing{Name: "thing"}})
+	if body != "from codec" || contentType != "application/json" {
+		t.Fatal("Codec for the default Content-Type was not used: ", body, contentType)
+	}
+
+	//and can be overridden per request
+	client.Post(&Params{Body: "text", Headers: http.Header{"Content-Type": {"text/plain"}}})
+	if body != `"text"` || contentType != "text/plain" {
+		t.Fatal("Content-Type was not overridden: ", body, contentType)
+	}
+}
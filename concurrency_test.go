@@ -0,0 +1,185 @@
+package grestclient
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+//These tests are meant to be run with -race.
+
+func TestConcurrentRequestsWhileConfiguring(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"name":"%s"}`, req.Header.Get("X-Version"))
+	}))
+	defer server.Close()
+
+	base, _ := url.Parse(server.URL)
+	client, _ := New(base)
+	SetupForJson(client)
+
+	stop := make(chan struct{})
+	var configuring sync.WaitGroup
+	configuring.Add(1)
+	go func() {
+		defer configuring.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			client.UpdateHeaders(func(h http.Header) {
+				h.Set("X-Version", strconv.Itoa(i))
+			})
+			client.UpdateQuery(func(q url.Values) {
+				q.Set("version", strconv.Itoa(i))
+			})
+			client.AddRequestMutators(func(r *http.Request) error { return nil })
+			client.AddResponseMutators(func(r *http.Response) error { return nil })
+			client.Use(func(next Handler) Handler { return next })
+			client.SetRetryPolicy(&RetryPolicy{MaxAttempts: 1})
+			client.SetSuccessRange(DefaultSuccessRange)
+			client.SetMaxBodySize(1 << 20)
+			client.SetRateLimiter(nil)
+			client.SetCircuitBreaker(nil)
+			client.SetPathRateLimiter("/other/*", NewRateLimiter(1000, 10, 0))
+			client.SetHttpDoer(&http.Client{})
+			client.SetMarshaler(JsonMarshalerFunc)
+			client.SetUnmarshaler(JsonUnmarshalerFunc)
+			client.Codecs().Register("application/json", Codec{JsonMarshalerFunc, JsonUnmarshalerFunc})
+			if i%10 == 0 {
+				client.SetRequestMutators(JsonContentTypeMutator, JsonAcceptMutator)
+				client.SetResponseMutators()
+				client.SetMiddleware()
+			}
+			client.Clone().Headers().Set("X-Clone", "clone")
+			time.Sleep(100 * time.Microsecond)
+		}
+	}()
+
+	var requests sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		requests.Add(1)
+		go func() {
+			defer requests.Done()
+			for j := 0; j < 25; j++ {
+				thing := &genericThing{}
+				res, err := client.Post(&Params{
+					Path:         "things",
+					Body:         genericThing{Name: "thing"},
+					UnmarshalMap: UnmarshalMap{200: thing},
+				})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if res.StatusCode != 200 {
+					t.Error("Wrong status: ", res.StatusCode)
+					return
+				}
+				if _, _, err := GetJSON[genericThing](client, &Params{Path: "things"}); err != nil {
+					t.Error(err)
+					return
+				}
+				client.GetHttpDoer()
+				client.Headers()
+			}
+		}()
+	}
+	requests.Wait()
+	close(stop)
+	configuring.Wait()
+}
+
+func TestRequestKeepsItsSnapshot(t *testing.T) {
+	var got http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		got = req.Header
+	}))
+	defer server.Close()
+
+	base, _ := url.Parse(server.URL)
+	client, _ := New(base)
+	client.Headers().Set("X-Version", "1")
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	client.Use(func(next Handler) Handler {
+		return func(r *http.Request, p *Params) (*http.Response, error) {
+			close(started)
+			<-release
+			return next(r, p)
+		}
+	})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		client.Get(&Params{})
+	}()
+
+	<-started
+	client.UpdateHeaders(func(h http.Header) {
+		h.Set("X-Version", "2")
+	})
+	client.AddRequestMutators(func(r *http.Request) error {
+		r.Header.Set("X-Mutated", "yes")
+		return nil
+	})
+	close(release)
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Request never finished.")
+	}
+	if got.Get("X-Version") != "1" || got.Get("X-Mutated") != "" {
+		t.Fatal("Request should not see settings changed after it started: ", got)
+	}
+	if client.Headers().Get("X-Version") != "2" || len(client.RequestMutators()) != 1 {
+		t.Fatal("Settings were not changed: ", client.Headers())
+	}
+}
+
+func TestDefaultHeadersAreCopiedPerRequest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	defer server.Close()
+
+	base, _ := url.Parse(server.URL)
+	client, _ := New(base)
+	client.AddRequestMutators(JsonAcceptMutator)
+	//leaves spare capacity in the slices of the default headers and query
+	client.UpdateHeaders(func(h http.Header) {
+		h.Add("Accept", "text/plain")
+		h.Add("Accept", "text/html")
+		h.Add("Accept", "text/csv")
+	})
+	client.UpdateQuery(func(q url.Values) {
+		q.Add("a", "1")
+		q.Add("a", "2")
+		q.Add("a", "3")
+	})
+
+	var requests sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		requests.Add(1)
+		go func() {
+			defer requests.Done()
+			for j := 0; j < 25; j++ {
+				client.Get(&Params{})
+			}
+		}()
+	}
+	requests.Wait()
+
+	if len(client.Headers()["Accept"]) != 3 || len(client.Query()["a"]) != 3 {
+		t.Fatal("Requests changed the defaults: ", client.Headers(), client.Query())
+	}
+}
@@ -0,0 +1,138 @@
+package grestclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+//ErrBodyTooLarge is returned, wrapped with the limit, when a response
+//body is bigger than the size set with SetMaxBodySize.
+var ErrBodyTooLarge = errors.New("grestclient: response body too large")
+
+//StreamUnmarshalerFunc decodes a response body into v while reading it
+//from r, instead of having the whole body read into a []byte first
+//like an UnmarshalerFunc.
+type StreamUnmarshalerFunc func(r io.Reader, v interface{}) error
+
+//JsonStreamUnmarshalerFunc decodes json from r into v.
+func JsonStreamUnmarshalerFunc(r io.Reader, v interface{}) error {
+	return json.NewDecoder(r).Decode(v)
+}
+
+//XmlStreamUnmarshalerFunc decodes xml from r into v.
+func XmlStreamUnmarshalerFunc(r io.Reader, v interface{}) error {
+	return xml.NewDecoder(r).Decode(v)
+}
+
+//SetStreamUnmarshaler sets the func used to decode response bodies as
+//they are read. It is used in place of the Unmarshaler unless a codec in
+//Codecs matches the response's Content-Type. When Params.Debug is set
+//the body is read into memory and the Unmarshaler is used so the body
+//can be restored. Pass nil to stop streaming.
+func (c *Client) SetStreamUnmarshaler(f StreamUnmarshalerFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.streamUnmarshaler = f
+}
+
+//SetMaxBodySize limits how many bytes of a response body are read for
+//unmarshaling. Bigger bodies fail with an error wrapping ErrBodyTooLarge
+//instead of being read into memory. 0 means there is no limit, which
+//is the default.
+func (c *Client) SetMaxBodySize(n int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.maxBodySize = n
+}
+
+//MaxBodySize returns the limit set with SetMaxBodySize.
+func (c *Client) MaxBodySize() int64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.maxBodySize
+}
+
+//streamUnmarshalerFor returns the StreamUnmarshalerFunc to use for a
+//response with the Content-Type contentType or nil if the body should be
+//read and given to an UnmarshalerFunc.
+func (c *Client) streamUnmarshalerFor(contentType string) StreamUnmarshalerFunc {
+	if c.streamUnmarshaler == nil {
+		return nil
+	}
+	if c.codecs != nil {
+		if _, ok := c.codecs.Unmarshaler(contentType); ok {
+			return nil
+		}
+	}
+	return c.streamUnmarshaler
+}
+
+//limitBody returns the body of res limited to the client's MaxBodySize.
+func (c *Client) limitBody(res *http.Response) (io.Reader, error) {
+	if c.maxBodySize <= 0 {
+		return res.Body, nil
+	}
+	if res.ContentLength > c.maxBodySize {
+		return nil, bodyTooLarge(c.maxBodySize)
+	}
+	return &limitedBody{r: res.Body, n: c.maxBodySize, limit: c.maxBodySize}, nil
+}
+
+func bodyTooLarge(limit int64) error {
+	return fmt.Errorf("%w: more than %d bytes", ErrBodyTooLarge, limit)
+}
+
+//limitedBody reads at most n bytes from r and fails if there are more.
+type limitedBody struct {
+	r     io.Reader
+	n     int64
+	limit int64
+}
+
+func (l *limitedBody) Read(p []byte) (int, error) {
+	if l.n <= 0 {
+		var one [1]byte
+		for {
+			n, err := l.r.Read(one[:])
+			if n > 0 {
+				return 0, bodyTooLarge(l.limit)
+			}
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+	if int64(len(p)) > l.n {
+		p = p[:l.n]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	return n, err
+}
+
+//snapshotWriter keeps the first limit bytes written to it and drops the
+//rest without failing.
+type snapshotWriter struct {
+	buf   bytes.Buffer
+	limit int64
+}
+
+func (w *snapshotWriter) Write(p []byte) (int, error) {
+	if room := w.room(); room > 0 {
+		if int64(len(p)) > room {
+			w.buf.Write(p[:room])
+		} else {
+			w.buf.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+func (w *snapshotWriter) room() int64 {
+	return w.limit - int64(w.buf.Len())
+}
@@ -0,0 +1,143 @@
+package grestclient
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestStreamUnmarshaler(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(`{"name":"streamed"}`))
+	}))
+	defer server.Close()
+
+	base, err := url.Parse(server.URL)
+	client, err := New(base)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.SetStreamUnmarshaler(JsonStreamUnmarshalerFunc)
+
+	var success genericThing
+	_, err = client.Get(&Params{Path: "thing", UnmarshalMap: UnmarshalMap{200: &success}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if success.Name != "streamed" {
+		t.Fatal("Response was not decoded: ", success)
+	}
+}
+
+func TestMaxBodySize(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/chunked" {
+			w.Write([]byte(strings.Repeat("x", 10)))
+			w.(http.Flusher).Flush()
+			w.Write([]byte(strings.Repeat("x", 10)))
+			return
+		}
+		w.Write([]byte(strings.Repeat("x", 20)))
+	}))
+	defer server.Close()
+
+	base, err := url.Parse(server.URL)
+	client, err := New(base)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.SetMaxBodySize(15)
+
+	for _, path := range []string{"sized", "chunked"} {
+		var success string
+		_, err = client.Get(&Params{Path: path, UnmarshalMap: UnmarshalMap{200: &success}})
+		if !errors.Is(err, ErrBodyTooLarge) {
+			t.Fatal("Expected a body too large error for ", path, " but got: ", err)
+		}
+	}
+
+	client.SetMaxBodySize(20)
+	var success string
+	_, err = client.Get(&Params{Path: "sized", UnmarshalMap: UnmarshalMap{200: &success}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(success) != 20 {
+		t.Fatal("Unexpected body: ", success)
+	}
+}
+
+func TestKeepBodyOpen(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("download"))
+	}))
+	defer server.Close()
+
+	base, err := url.Parse(server.URL)
+	client, err := New(base)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var success string
+	res, err := client.Get(&Params{
+		Path:         "file",
+		KeepBodyOpen: true,
+		UnmarshalMap: UnmarshalMap{200: &success},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if success != "" {
+		t.Fatal("Nothing should be unmarshaled when the body is kept open.")
+	}
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "download" {
+		t.Fatal("Unexpected body: ", string(b))
+	}
+}
+
+func TestStreamUnmarshalerKeepsErrorBody(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"message":"broken"} trailing`))
+	}))
+	defer server.Close()
+
+	base, _ := url.Parse(server.URL)
+	client, _ := New(base)
+	client.SetStreamUnmarshaler(JsonStreamUnmarshalerFunc)
+	client.SetSuccessRange(DefaultSuccessRange)
+
+	var problem genericProblem
+	_, err := client.Get(&Params{UnmarshalMap: UnmarshalMap{500: &problem}})
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) {
+		t.Fatal("Expected an HTTPError: ", err)
+	}
+	if string(httpErr.Body) != `{"message":"broken"} trailing` || problem.Message != "broken" {
+		t.Fatal("Body was not kept: ", string(httpErr.Body), problem)
+	}
+	if httpErr.Payload != &problem {
+		t.Fatal("Payload was not set: ", httpErr.Payload)
+	}
+
+	//a body the decoder can't read still ends up in the error
+	var things []genericThing
+	_, err = client.Get(&Params{UnmarshalMap: UnmarshalMap{500: &things}})
+	if !errors.As(err, &httpErr) || string(httpErr.Body) != `{"message":"broken"} trailing` {
+		t.Fatal("Body was not kept after a decoding error: ", err)
+	}
+}
@@ -0,0 +1,153 @@
+package grestclient
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/http"
+	rt "reflect"
+)
+
+//DelimitedContentType is the Content-Type set by SetupForDelimited. It
+//is not application/x-protobuf, which is a single message without a
+//length in front of it.
+const DelimitedContentType = "application/x-protobuf-delimited"
+
+//DelimitedMarshalerFunc writes each message as a uvarint length followed
+//by its bytes, the length-delimited framing used for streams of protobuf
+//messages. v can be an encoding.BinaryMarshaler, a []byte, or a slice of
+//either to send several messages in one body.
+func DelimitedMarshalerFunc(v interface{}) (ReadLener, error) {
+	buf := &bytes.Buffer{}
+
+	rv := rt.ValueOf(v)
+	if _, ok := v.([]byte); !ok && rv.Kind() == rt.Slice {
+		for i := 0; i < rv.Len(); i++ {
+			if err := writeDelimited(buf, rv.Index(i).Interface()); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	}
+
+	if err := writeDelimited(buf, v); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+//DelimitedUnmarshalerFunc reads uvarint length-delimited messages.
+//v can be an encoding.BinaryUnmarshaler or *[]byte to read a single
+//message, or a *[][]byte or pointer to a slice whose elements
+//(or pointers to them) are encoding.BinaryUnmarshalers to read all of them.
+func DelimitedUnmarshalerFunc(b []byte, v interface{}) error {
+	switch t := v.(type) {
+	case *[]byte:
+		msg, _, err := readDelimited(b)
+		if err != nil {
+			return err
+		}
+		*t = msg
+		return nil
+	case encoding.BinaryUnmarshaler:
+		msg, _, err := readDelimited(b)
+		if err != nil {
+			return err
+		}
+		return t.UnmarshalBinary(msg)
+	}
+
+	rv := rt.ValueOf(v)
+	if rv.Kind() != rt.Ptr || rv.IsNil() || rv.Elem().Kind() != rt.Slice {
+		return fmt.Errorf("Did not know how to unmarshal delimited messages into %T.", v)
+	}
+	slice := rv.Elem()
+	elemType := slice.Type().Elem()
+	for len(b) > 0 {
+		msg, n, err := readDelimited(b)
+		if err != nil {
+			return err
+		}
+		b = b[n:]
+
+		elem := rt.New(elemType)
+		switch target := elem.Interface().(type) {
+		case *[]byte:
+			*target = msg
+		case encoding.BinaryUnmarshaler:
+			if err = target.UnmarshalBinary(msg); err != nil {
+				return err
+			}
+		default:
+			if elemType.Kind() != rt.Ptr {
+				return fmt.Errorf("Did not know how to unmarshal a delimited message into %s.", elemType)
+			}
+			//slice of pointers, like []*Message
+			elem.Elem().Set(rt.New(elemType.Elem()))
+			u, ok := elem.Elem().Interface().(encoding.BinaryUnmarshaler)
+			if !ok {
+				return fmt.Errorf("Did not know how to unmarshal a delimited message into %s.", elemType)
+			}
+			if err = u.UnmarshalBinary(msg); err != nil {
+				return err
+			}
+		}
+		slice.Set(rt.Append(slice, elem.Elem()))
+	}
+	return nil
+}
+
+func writeDelimited(buf *bytes.Buffer, v interface{}) error {
+	var msg []byte
+	switch t := v.(type) {
+	case []byte:
+		msg = t
+	case encoding.BinaryMarshaler:
+		var err error
+		if msg, err = t.MarshalBinary(); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("Did not know how to use %T as a delimited message.", v)
+	}
+
+	var prefix [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(prefix[:], uint64(len(msg)))
+	buf.Write(prefix[:n])
+	buf.Write(msg)
+	return nil
+}
+
+//readDelimited returns the first message in b and the number of bytes
+//it took up including its length prefix.
+func readDelimited(b []byte) ([]byte, int, error) {
+	size, n := binary.Uvarint(b)
+	if n <= 0 {
+		return nil, 0, errors.New("Could not read the length of a delimited message.")
+	}
+	//compared before adding so a huge length can't overflow
+	if size > uint64(len(b)-n) {
+		return nil, 0, errors.New("Delimited message is shorter than its length says.")
+	}
+	end := n + int(size)
+	return b[n:end], end, nil
+}
+
+//DelimitedContentTypeMutator sets the Content-Type of the request to be
+//application/x-protobuf-delimited
+func DelimitedContentTypeMutator(r *http.Request) error {
+	r.Header.Add("Content-Type", DelimitedContentType)
+	return nil
+}
+
+//SetupForDelimited is a convenience method that sets the
+//marshaler and unmarshaler funcs on the client to be the
+//Delimited funcs in this package. It also sets the default
+//Content-Type header to application/x-protobuf-delimited.
+func SetupForDelimited(c *Client) {
+	c.SetMarshaler(DelimitedMarshalerFunc)
+	c.SetUnmarshaler(DelimitedUnmarshalerFunc)
+	setDefaultHeaders(c, DelimitedContentType, "")
+}
@@ -0,0 +1,88 @@
+package grestclient
+
+import (
+	"io/ioutil"
+	"testing"
+)
+
+type delimitedMessage struct {
+	Text string
+}
+
+func (m delimitedMessage) MarshalBinary() ([]byte, error) {
+	return []byte(m.Text), nil
+}
+
+func (m *delimitedMessage) UnmarshalBinary(b []byte) error {
+	m.Text = string(b)
+	return nil
+}
+
+func TestDelimitedMarshalers(t *testing.T) {
+	r, err := DelimitedMarshalerFunc([]delimitedMessage{{"one"}, {"two"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadAll(r)
+	if string(b) != "\x03one\x03two" {
+		t.Fatalf("Unexpected framing: %q", b)
+	}
+
+	var messages []delimitedMessage
+	if err = DelimitedUnmarshalerFunc(b, &messages); err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 2 || messages[1].Text != "two" {
+		t.Fatal("Unexpected messages: ", messages)
+	}
+
+	var pointers []*delimitedMessage
+	if err = DelimitedUnmarshalerFunc(b, &pointers); err != nil {
+		t.Fatal(err)
+	}
+	if len(pointers) != 2 || pointers[0].Text != "one" {
+		t.Fatal("Unexpected messages: ", pointers)
+	}
+
+	var single delimitedMessage
+	if err = DelimitedUnmarshalerFunc(b, &single); err != nil {
+		t.Fatal(err)
+	}
+	if single.Text != "one" {
+		t.Fatal("Unexpected message: ", single)
+	}
+
+	if err = DelimitedUnmarshalerFunc([]byte("\x09short"), &single); err == nil {
+		t.Fatal("Expected an error for a truncated message.")
+	}
+}
+
+func TestDelimitedUnmarshalerMalformed(t *testing.T) {
+	bodies := map[string][]byte{
+		"empty":           {},
+		"unfinished":      {0x80},
+		"varint overflow": {0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01},
+		"huge length":     {0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01, 'a'},
+		"long length":     {0xff, 0xff, 0xff, 0xff, 0x0f, 'a'},
+	}
+	for name, b := range bodies {
+		var single delimitedMessage
+		if err := DelimitedUnmarshalerFunc(b, &single); err == nil {
+			t.Fatal("Expected an error for ", name)
+		}
+		var messages []delimitedMessage
+		if err := DelimitedUnmarshalerFunc(append([]byte("\x03one"), b...), &messages); err == nil && len(b) > 0 {
+			t.Fatal("Expected an error for ", name, " after a message")
+		}
+	}
+}
+
+func TestDelimitedCodecMediaType(t *testing.T) {
+	codecs := DefaultCodecs()
+	if _, ok := codecs.Unmarshaler("application/x-protobuf"); ok {
+		t.Fatal("A single protobuf message should not be read as delimited.")
+	}
+	if _, ok := codecs.Unmarshaler(DelimitedContentType); !ok {
+		t.Fatal("Delimited codec was not registered.")
+	}
+}
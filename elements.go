@@ -0,0 +1,213 @@
+package grestclient
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"iter"
+	"mime"
+	"net/http"
+)
+
+//ElementIterator decodes the elements of a newline delimited json body
+//or of a top level json array one at a time. Elements are only read
+//from the connection as Next is called so a slow consumer slows down the
+//download instead of the body piling up in memory.
+//
+//	it, err := c.Elements("GET", &Params{Path: "logs"})
+//	if err != nil {
+//		return err
+//	}
+//	defer it.Close()
+//	for it.Next() {
+//		var entry LogEntry
+//		if err := it.Decode(&entry); err != nil {
+//			return err
+//		}
+//	}
+//	return it.Err()
+type ElementIterator struct {
+	Response *http.Response
+
+	ctx     context.Context
+	dec     *json.Decoder
+	array   bool
+	started bool
+	done    bool
+	raw     json.RawMessage
+	err     error
+}
+
+//Elements performs a request like Do and returns an iterator over the
+//elements in the response body. The body is treated as newline delimited
+//json when the Content-Type says so (application/x-ndjson,
+//application/jsonl and the like) or when it doesn't start with '['.
+//Otherwise it is read as a json array.
+//
+//The UnmarshalMap is not used. If the status is not successful the
+//response body is closed and an *HTTPError is returned.
+//Params.Context is checked before every element.
+func (c *Client) Elements(method string, p *Params) (*ElementIterator, error) {
+	req := *p
+	req.KeepBodyOpen = true
+	req.UnmarshalMap = nil
+	req.fallback = nil
+
+	res, err := c.Do(method, &req)
+	if err != nil {
+		if res != nil {
+			res.Body.Close()
+		}
+		return nil, err
+	}
+
+	if !c.successful(res.StatusCode) {
+		defer res.Body.Close()
+		body, _ := ioutil.ReadAll(io.LimitReader(res.Body, ErrorBodySnapshotSize))
+		return nil, newHTTPError(res.Request, res, body, nil)
+	}
+
+	reader := bufio.NewReader(res.Body)
+	it := &ElementIterator{
+		Response: res,
+		ctx:      req.context(),
+		dec:      json.NewDecoder(reader),
+	}
+
+	if !ndjson(res.Header.Get("Content-Type")) {
+		it.array = firstByte(reader) == '['
+	}
+	return it, nil
+}
+
+//Next reads the next element, returning false when there are no more
+//or an error happened. Check Err afterwards.
+func (it *ElementIterator) Next() bool {
+	if it.done {
+		return false
+	}
+	if err := canceled(it.ctx, nil); err != nil {
+		return it.fail(err)
+	}
+
+	if it.array && !it.started {
+		it.started = true
+		if _, err := it.dec.Token(); err != nil {
+			return it.fail(err)
+		}
+	}
+
+	if it.array && !it.dec.More() {
+		if _, err := it.dec.Token(); err != nil {
+			return it.fail(err)
+		}
+		return it.fail(nil)
+	}
+
+	it.raw = nil
+	if err := it.dec.Decode(&it.raw); err != nil {
+		if err == io.EOF && !it.array {
+			err = nil
+		}
+		return it.fail(canceled(it.ctx, err))
+	}
+	return true
+}
+
+//Decode unmarshals the current element into v.
+func (it *ElementIterator) Decode(v interface{}) error {
+	if it.raw == nil {
+		return errors.New("Decode called without a successful call to Next.")
+	}
+	return json.Unmarshal(it.raw, v)
+}
+
+//Raw returns the json of the current element.
+func (it *ElementIterator) Raw() json.RawMessage {
+	return it.raw
+}
+
+//Err returns the error that stopped the iteration, if any.
+func (it *ElementIterator) Err() error {
+	return it.err
+}
+
+//Close closes the response body. It is safe to call more than once.
+func (it *ElementIterator) Close() error {
+	it.done = true
+	return it.Response.Body.Close()
+}
+
+func (it *ElementIterator) fail(err error) bool {
+	it.err = err
+	it.done = true
+	it.raw = nil
+	return false
+}
+
+//ElementsOf performs a request like Client.Elements and yields each
+//element decoded into a T. The body is closed when the loop ends.
+//Any error, including one from making the request, is yielded last
+//with the zero T.
+func ElementsOf[T any](c *Client, method string, p *Params) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var zero T
+		it, err := c.Elements(method, p)
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+		defer it.Close()
+
+		for it.Next() {
+			var v T
+			if err := it.Decode(&v); err != nil {
+				yield(zero, err)
+				return
+			}
+			if !yield(v, nil) {
+				return
+			}
+		}
+		if err := it.Err(); err != nil {
+			yield(zero, err)
+		}
+	}
+}
+
+//ndjson reports whether contentType is one of the newline delimited
+//json media types.
+func ndjson(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch mediaType {
+	case "application/x-ndjson", "application/ndjson", "application/jsonl",
+		"application/x-jsonlines", "application/jsonlines":
+		return true
+	}
+	return false
+}
+
+//firstByte returns the first byte in r that isn't whitespace without
+//consuming it, or 0 if there isn't one.
+func firstByte(r *bufio.Reader) byte {
+	for i := 1; ; i++ {
+		b, err := r.Peek(i)
+		if len(b) < i {
+			return 0
+		}
+		switch c := b[i-1]; c {
+		case ' ', '\t', '\r', '\n':
+		default:
+			return c
+		}
+		if err != nil {
+			return 0
+		}
+	}
+}
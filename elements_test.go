@@ -0,0 +1,126 @@
+package grestclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestElementsNdjson(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Write([]byte("{\"name\":\"one\"}\n{\"name\":\"two\"}\n"))
+	}))
+	defer server.Close()
+
+	base, err := url.Parse(server.URL)
+	client, err := New(base)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	it, err := client.Elements("GET", &Params{Path: "logs"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer it.Close()
+
+	var names []string
+	for it.Next() {
+		var thing genericThing
+		if err := it.Decode(&thing); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, thing.Name)
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 2 || names[1] != "two" {
+		t.Fatal("Unexpected elements: ", names)
+	}
+}
+
+func TestElementsOfArray(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(` [{"name":"one"}, {"name":"two"}, {"name":"three"}]`))
+	}))
+	defer server.Close()
+
+	base, err := url.Parse(server.URL)
+	client, err := New(base)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for thing, err := range ElementsOf[genericThing](client, "GET", &Params{Path: "cursor"}) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, thing.Name)
+	}
+	if len(names) != 3 || names[2] != "three" {
+		t.Fatal("Unexpected elements: ", names)
+	}
+}
+
+func TestElementsStopsWhenContextIsCanceled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("[1, 2, 3]"))
+	}))
+	defer server.Close()
+
+	base, err := url.Parse(server.URL)
+	client, err := New(base)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	it, err := client.Elements("GET", &Params{Path: "numbers", Context: ctx})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer it.Close()
+
+	if !it.Next() {
+		t.Fatal("Expected a first element: ", it.Err())
+	}
+	cancel()
+	if it.Next() {
+		t.Fatal("Did not expect another element after canceling.")
+	}
+	if !errors.Is(it.Err(), ErrCanceled) {
+		t.Fatal("Expected a canceled error but got: ", it.Err())
+	}
+}
+
+func TestElementsErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("no such cursor"))
+	}))
+	defer server.Close()
+
+	base, err := url.Parse(server.URL)
+	client, err := New(base)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.Elements("GET", &Params{Path: "cursor"})
+	if !IsNotFound(err) {
+		t.Fatal("Expected a not found error but got: ", err)
+	}
+}
@@ -0,0 +1,140 @@
+package grestclient
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+//ErrorBodySnapshotSize is the most bytes of a response body kept in
+//HTTPError.Body when the body wasn't already read for unmarshaling.
+var ErrorBodySnapshotSize int64 = 4 << 10
+
+//SuccessRange is an inclusive range of status codes considered successful.
+type SuccessRange struct {
+	Min int
+	Max int
+}
+
+//DefaultSuccessRange covers the 2xx status codes.
+var DefaultSuccessRange = &SuccessRange{Min: 200, Max: 299}
+
+//Contains reports whether code is inside the range.
+func (s *SuccessRange) Contains(code int) bool {
+	return code >= s.Min && code <= s.Max
+}
+
+//SetSuccessRange turns on status errors. Responses with a status code
+//outside of the range are returned together with an *HTTPError.
+//The UnmarshalMap is still used so an error payload can be decoded
+//into its destination as well as being put in HTTPError.Payload.
+//Pass nil to go back to the default where any status is returned without
+//an error.
+func (c *Client) SetSuccessRange(s *SuccessRange) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.successRange = s
+}
+
+//SuccessRange returns the range set with SetSuccessRange or nil if status
+//errors are off.
+func (c *Client) SuccessRange() *SuccessRange {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.successRange
+}
+
+//HTTPError is returned when status errors are turned on with
+//SetSuccessRange and the response status is outside of the range.
+type HTTPError struct {
+	Method string
+	//URL is the request url with the password and the query parameters
+	//in DefaultRedactQuery replaced by REDACTED, since errors end up in logs.
+	URL        string
+	StatusCode int
+	Status     string
+	Header     http.Header
+
+	//Body holds the response body. If the body was not read for
+	//unmarshaling it is cut off at ErrorBodySnapshotSize bytes.
+	Body []byte
+
+	//Payload is the UnmarshalMap destination for the status code if
+	//there was one and the body was unmarshaled into it without error.
+	Payload interface{}
+}
+
+func newHTTPError(r *http.Request, res *http.Response, body []byte, payload interface{}) *HTTPError {
+	e := &HTTPError{
+		StatusCode: res.StatusCode,
+		Status:     res.Status,
+		Header:     res.Header,
+		Body:       body,
+		Payload:    payload,
+	}
+	if r != nil {
+		e.Method = r.Method
+		e.URL = redactURL(r.URL, DefaultRedactQuery)
+	}
+	return e
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("grestclient: %s %s: %s", e.Method, e.URL, e.Status)
+}
+
+//StatusCode returns the status code of err if it is or wraps an
+//*HTTPError, otherwise 0.
+func StatusCode(err error) int {
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode
+	}
+	return 0
+}
+
+//IsNotFound reports whether err is an *HTTPError with a 404 status.
+func IsNotFound(err error) bool {
+	return StatusCode(err) == http.StatusNotFound
+}
+
+//IsConflict reports whether err is an *HTTPError with a 409 status.
+func IsConflict(err error) bool {
+	return StatusCode(err) == http.StatusConflict
+}
+
+//IsPreconditionFailed reports whether err is a *ConflictError or an
+//*HTTPError with a 412 status.
+func IsPreconditionFailed(err error) bool {
+	return StatusCode(err) == http.StatusPreconditionFailed
+}
+
+//IsUnauthorized reports whether err is an *HTTPError with a 401 status.
+func IsUnauthorized(err error) bool {
+	return StatusCode(err) == http.StatusUnauthorized
+}
+
+//IsForbidden reports whether err is an *HTTPError with a 403 status.
+func IsForbidden(err error) bool {
+	return StatusCode(err) == http.StatusForbidden
+}
+
+//IsRetryable reports whether trying again later might succeed. That is
+//the case for an *HTTPError with a 408 status or one of the
+//DefaultRetryStatusCodes, and for transport errors that IsRetryableError
+//considers temporary.
+func IsRetryable(err error) bool {
+	code := StatusCode(err)
+	if code == 0 {
+		return IsRetryableError(err)
+	}
+	if code == http.StatusRequestTimeout {
+		return true
+	}
+	for _, c := range DefaultRetryStatusCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,148 @@
+package grestclient
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestNoHTTPErrorByDefault(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	base, err := url.Parse(server.URL)
+	client, err := New(base)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := client.Get(&Params{Path: "get"})
+	if err != nil {
+		t.Fatal("Did not expect an error without a success range: ", err)
+	}
+	if res.StatusCode != http.StatusInternalServerError {
+		t.Fatal("Unexpected status code: ", res.StatusCode)
+	}
+}
+
+func TestHTTPErrorOutsideSuccessRange(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("X-Request-Id", "abc")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(strings.Repeat("x", 10)))
+	}))
+	defer server.Close()
+
+	base, err := url.Parse(server.URL)
+	client, err := New(base)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.SetSuccessRange(DefaultSuccessRange)
+
+	old := ErrorBodySnapshotSize
+	ErrorBodySnapshotSize = 4
+	defer func() { ErrorBodySnapshotSize = old }()
+
+	res, err := client.Get(&Params{Path: "missing"})
+	if res == nil {
+		t.Fatal("Expected the response to be returned with the error.")
+	}
+
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) {
+		t.Fatal("Expected an HTTPError but got: ", err)
+	}
+	if httpErr.Method != "GET" || !strings.HasSuffix(httpErr.URL, "/missing") {
+		t.Fatal("Unexpected request in error: ", httpErr.Method, httpErr.URL)
+	}
+	if httpErr.Header.Get("X-Request-Id") != "abc" {
+		t.Fatal("Response headers missing from error.")
+	}
+	if string(httpErr.Body) != "xxxx" {
+		t.Fatal("Body snapshot was not bounded: ", string(httpErr.Body))
+	}
+	if !IsNotFound(err) || IsConflict(err) || IsRetryable(err) {
+		t.Fatal("Error classified incorrectly.")
+	}
+}
+
+func TestHTTPErrorCarriesPayload(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusConflict)
+		w.Write([]byte("already exists"))
+	}))
+	defer server.Close()
+
+	base, err := url.Parse(server.URL)
+	client, err := New(base)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.SetSuccessRange(DefaultSuccessRange)
+
+	var errResult string
+	_, err = client.Put(&Params{
+		Path:         "put",
+		Body:         "thing",
+		UnmarshalMap: UnmarshalMap{http.StatusConflict: &errResult},
+	})
+
+	if !IsConflict(err) {
+		t.Fatal("Expected a conflict error but got: ", err)
+	}
+	var httpErr *HTTPError
+	errors.As(err, &httpErr)
+	if p, ok := httpErr.Payload.(*string); !ok || *p != "already exists" {
+		t.Fatal("Payload was not decoded: ", httpErr.Payload)
+	}
+	if string(httpErr.Body) != "already exists" {
+		t.Fatal("Unexpected body: ", string(httpErr.Body))
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	if !IsRetryable(&HTTPError{StatusCode: http.StatusServiceUnavailable}) {
+		t.Fatal("503 should be retryable.")
+	}
+	if IsRetryable(&HTTPError{StatusCode: http.StatusBadRequest}) {
+		t.Fatal("400 should not be retryable.")
+	}
+	if IsRetryable(errors.New("boom")) {
+		t.Fatal("Plain errors should not be retryable.")
+	}
+}
+
+func TestHTTPErrorHidesCredentials(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	base, _ := url.Parse(server.URL)
+	base.User = url.UserPassword("bob", "hunter2")
+	client, _ := New(base,
+		WithSuccessRange(DefaultSuccessRange),
+		WithAuthenticator(APIKeyAuth{Name: "api_key", Value: "SECRET", InQuery: true}),
+	)
+
+	_, err := client.Get(&Params{Path: "x", Query: url.Values{"page": {"2"}}})
+	if !IsNotFound(err) {
+		t.Fatal("Expected a 404 error: ", err)
+	}
+	msg := err.Error()
+	if strings.Contains(msg, "hunter2") || strings.Contains(msg, "SECRET") {
+		t.Fatal("Error should not show credentials: ", msg)
+	}
+	if !strings.Contains(msg, "bob") || !strings.Contains(msg, "page=2") {
+		t.Fatal("Error should still show the url: ", msg)
+	}
+}
@@ -0,0 +1,214 @@
+package grestclient
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+//ConflictError is returned when a request sent with If-Match is answered
+//with 412 Precondition Failed because the resource changed since its
+//ETag was read. It unwraps to the *HTTPError for the response.
+type ConflictError struct {
+	*HTTPError
+	//IfMatch is the ETag the request was sent with.
+	IfMatch string
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("grestclient: %s %s: %s was modified", e.Method, e.URL, e.IfMatch)
+}
+
+func (e *ConflictError) Unwrap() error {
+	return e.HTTPError
+}
+
+func newConflictError(r *http.Request, response *http.Response, ifMatch string) *ConflictError {
+	body, _ := ioutil.ReadAll(io.LimitReader(response.Body, ErrorBodySnapshotSize))
+	return &ConflictError{
+		HTTPError: newHTTPError(r, response, body, nil),
+		IfMatch:   ifMatch,
+	}
+}
+
+//ETagTracker remembers the ETag of every resource read with GET and sends
+//it with If-Match when the same path is changed with PUT, PATCH or
+//DELETE, unless the request has an If-Match already. It is added to a
+//client as Middleware:
+//
+//	etags := NewETagTracker()
+//	c.Use(etags.Middleware())
+//
+//A 412 Precondition Failed is returned together with a *ConflictError and
+//the ETag is forgotten, so the resource has to be read again. ETags in
+//the responses to PUT and PATCH replace the ones remembered. Weak ETags,
+//like W/"1", are treated as no ETag since If-Match compares ETags
+//strongly and would never match them.
+type ETagTracker struct {
+	mu   sync.Mutex
+	tags map[string]string
+}
+
+//NewETagTracker returns an empty ETagTracker.
+func NewETagTracker() *ETagTracker {
+	return &ETagTracker{tags: make(map[string]string)}
+}
+
+//ETag returns the ETag remembered for the path of u.
+func (t *ETagTracker) ETag(u *url.URL) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.tags[etagKey(u)]
+}
+
+//Forget drops the ETag remembered for the path of u.
+func (t *ETagTracker) Forget(u *url.URL) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.tags, etagKey(u))
+}
+
+func (t *ETagTracker) remember(u *url.URL, etag string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.tags[etagKey(u)] = etag
+}
+
+//weakETag reports whether etag is a weak validator.
+func weakETag(etag string) bool {
+	return strings.HasPrefix(etag, "W/")
+}
+
+func etagKey(u *url.URL) string {
+	return u.Scheme + "://" + u.Host + u.EscapedPath()
+}
+
+//Middleware returns the Middleware tracking ETags.
+func (t *ETagTracker) Middleware() Middleware {
+	return func(next Handler) Handler {
+		return func(r *http.Request, p *Params) (*http.Response, error) {
+			switch r.Method {
+			case "PUT", "PATCH", "DELETE":
+				if r.Header.Get("If-Match") == "" {
+					if etag := t.ETag(r.URL); etag != "" {
+						r.Header.Set("If-Match", etag)
+					}
+				}
+			}
+
+			response, err := next(r, p)
+			if err != nil {
+				return response, err
+			}
+			if response.StatusCode == http.StatusPreconditionFailed {
+				t.Forget(r.URL)
+				return response, newConflictError(r, response, r.Header.Get("If-Match"))
+			}
+
+			etag := response.Header.Get("ETag")
+			if weakETag(etag) {
+				etag = ""
+			}
+			switch {
+			case response.StatusCode >= 300:
+			case r.Method == "DELETE":
+				t.Forget(r.URL)
+			case r.Method == "GET" || r.Method == "PUT" || r.Method == "PATCH":
+				if etag != "" {
+					t.remember(r.URL, etag)
+				} else if r.Method != "GET" {
+					t.Forget(r.URL)
+				}
+			}
+			return response, nil
+		}
+	}
+}
+
+//ReadModifyWrite updates a resource with optimistic concurrency. It GETs
+//the resource described by p into a T, calls mutate with it and sends it
+//back with method, PUT if empty, and an If-Match with the ETag of the GET.
+//If the resource changed in between and the server answers 412 it starts
+//over, making up to attempts tries in total. attempts defaults to 3.
+//
+//The written value and the response to the write are returned. The
+//error is a *ConflictError if every attempt conflicted, an *HTTPError if
+//a request got a status outside of the client's success range or the
+//error mutate returned, which stops the loop right away. A resource read
+//without an ETag or with a weak one is not written.
+func ReadModifyWrite[T any](c *Client, method string, p *Params, attempts int, mutate func(*T) error) (T, *http.Response, error) {
+	if method == "" {
+		method = "PUT"
+	}
+	if attempts <= 0 {
+		attempts = 3
+	}
+
+	var zero T
+	var response *http.Response
+	var err error
+	for attempt := 0; attempt < attempts; attempt++ {
+		read := *p
+		read.Body = nil
+		var value T
+		value, response, err = DoAs[T](c, "GET", &read)
+		if err != nil {
+			return zero, response, err
+		}
+		if !c.successful(response.StatusCode) {
+			return zero, response, newHTTPError(response.Request, response, nil, nil)
+		}
+		etag := response.Header.Get("ETag")
+		if etag == "" {
+			return zero, response, errors.New("Can't update a resource that was read without an ETag.")
+		}
+		if weakETag(etag) {
+			return zero, response, errors.New("Can't update a resource that was read with a weak ETag, If-Match needs a strong one.")
+		}
+
+		if err = mutate(&value); err != nil {
+			return zero, response, err
+		}
+
+		write := *p
+		write.Body = &value
+		write.Headers = headerCopy(p.Headers)
+		if write.Headers == nil {
+			write.Headers = make(http.Header)
+		}
+		write.Headers.Set("If-Match", etag)
+		write.UnmarshalMap = nil
+		write.KeepBodyOpen = true
+
+		response, err = c.Do(method, &write)
+		if err == nil {
+			switch {
+			case response.StatusCode == http.StatusPreconditionFailed:
+				err = newConflictError(response.Request, response, etag)
+			case !c.successful(response.StatusCode):
+				err = newHTTPError(response.Request, response, nil, nil)
+			}
+		}
+		if response != nil {
+			response.Body.Close()
+		}
+		if err == nil {
+			return value, response, nil
+		}
+		if !IsPreconditionFailed(err) {
+			return zero, response, err
+		}
+		var conflict *ConflictError
+		if !errors.As(err, &conflict) {
+			var httpErr *HTTPError
+			errors.As(err, &httpErr)
+			err = &ConflictError{HTTPError: httpErr, IfMatch: etag}
+		}
+	}
+	return zero, response, err
+}
@@ -0,0 +1,207 @@
+package grestclient
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+//documentStore serves one json document whose ETag changes on every write.
+type documentStore struct {
+	mu       sync.Mutex
+	version  int
+	name     string
+	ifMatch  []string
+	conflict func() //called before a write is checked
+	weak     bool
+}
+
+func (d *documentStore) etag() string {
+	if d.weak {
+		return `W/"` + strconv.Itoa(d.version) + `"`
+	}
+	return `"` + strconv.Itoa(d.version) + `"`
+}
+
+func (d *documentStore) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" && d.conflict != nil {
+		d.conflict()
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	switch req.Method {
+	case "GET":
+		w.Header().Set("ETag", d.etag())
+		json.NewEncoder(w).Encode(genericThing{Name: d.name})
+	case "PUT":
+		d.ifMatch = append(d.ifMatch, req.Header.Get("If-Match"))
+		if req.Header.Get("If-Match") != d.etag() {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			w.Write([]byte("stale"))
+			return
+		}
+		var thing genericThing
+		body, _ := ioutil.ReadAll(req.Body)
+		json.Unmarshal(body, &thing)
+		d.name = thing.Name
+		d.version++
+		w.Header().Set("ETag", d.etag())
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (d *documentStore) bump(name string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.name = name
+	d.version++
+}
+
+func newDocumentClient(d *documentStore) (*Client, func()) {
+	server := httptest.NewServer(d)
+	base, _ := url.Parse(server.URL)
+	client, _ := New(base)
+	SetupForJson(client)
+	return client, server.Close
+}
+
+func TestETagTracker(t *testing.T) {
+	d := &documentStore{name: "a"}
+	client, done := newDocumentClient(d)
+	defer done()
+	etags := NewETagTracker()
+	client.Use(etags.Middleware())
+
+	client.Get(&Params{Path: "doc"})
+	if _, err := client.Put(&Params{Path: "doc", Body: genericThing{Name: "b"}}); err != nil {
+		t.Fatal(err)
+	}
+	if d.ifMatch[0] != `"0"` || d.name != "b" {
+		t.Fatal("ETag from the GET was not sent: ", d.ifMatch)
+	}
+
+	//the ETag of the PUT response is remembered
+	u, _ := url.Parse(client.BaseUrl().String() + "/doc")
+	if etags.ETag(u) != `"1"` {
+		t.Fatal("ETag of the write was not remembered: ", etags.ETag(u))
+	}
+
+	d.bump("c")
+	res, err := client.Put(&Params{Path: "doc", Body: genericThing{Name: "d"}})
+	var conflict *ConflictError
+	if !errors.As(err, &conflict) || !IsPreconditionFailed(err) || res.StatusCode != 412 {
+		t.Fatal("Expected a conflict: ", err)
+	}
+	if conflict.IfMatch != `"1"` || string(conflict.Body) != "stale" || d.name != "c" {
+		t.Fatal("Wrong conflict: ", conflict.IfMatch, string(conflict.Body))
+	}
+	if etags.ETag(u) != "" {
+		t.Fatal("Stale ETag should be forgotten.")
+	}
+
+	//an If-Match set by the caller is left alone
+	client.Get(&Params{Path: "doc"})
+	client.Put(&Params{Path: "doc", Headers: http.Header{"If-Match": {"*"}}})
+	if d.ifMatch[2] != "*" {
+		t.Fatal("If-Match was overwritten: ", d.ifMatch[2])
+	}
+}
+
+func TestReadModifyWrite(t *testing.T) {
+	d := &documentStore{name: "a"}
+	client, done := newDocumentClient(d)
+	defer done()
+
+	//someone else writes in between the first read and write
+	conflicts := 1
+	d.conflict = func() {
+		if conflicts > 0 {
+			conflicts--
+			d.bump("other")
+		}
+	}
+	thing, res, err := ReadModifyWrite(client, "", &Params{Path: "doc"}, 3, func(thing *genericThing) error {
+		thing.Name += "!"
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusNoContent || thing.Name != "other!" || d.name != "other!" {
+		t.Fatal("Wrong update: ", res.StatusCode, thing, d.name)
+	}
+	if len(d.ifMatch) != 2 || d.ifMatch[0] != `"0"` || d.ifMatch[1] != `"1"` {
+		t.Fatal("Update was not retried with the new ETag: ", d.ifMatch)
+	}
+
+	conflicts = 5
+	_, _, err = ReadModifyWrite(client, "PUT", &Params{Path: "doc"}, 2, func(thing *genericThing) error {
+		return nil
+	})
+	var conflict *ConflictError
+	if !errors.As(err, &conflict) || len(d.ifMatch) != 4 {
+		t.Fatal("Expected a conflict after two attempts: ", err, d.ifMatch)
+	}
+
+	stop := errors.New("stop")
+	_, _, err = ReadModifyWrite(client, "PUT", &Params{Path: "doc"}, 2, func(thing *genericThing) error {
+		return stop
+	})
+	if err != stop || len(d.ifMatch) != 4 {
+		t.Fatal("Error from mutate should stop the update: ", err)
+	}
+}
+
+func TestReadModifyWriteWithStatusErrors(t *testing.T) {
+	d := &documentStore{name: "a"}
+	client, done := newDocumentClient(d)
+	defer done()
+	client.SetSuccessRange(DefaultSuccessRange)
+	client.Use(NewETagTracker().Middleware())
+
+	conflicts := 1
+	d.conflict = func() {
+		if conflicts > 0 {
+			conflicts--
+			d.bump("other")
+		}
+	}
+	thing, _, err := ReadModifyWrite(client, "", &Params{Path: "doc"}, 0, func(thing *genericThing) error {
+		thing.Name = "mine"
+		return nil
+	})
+	if err != nil || thing.Name != "mine" || d.name != "mine" {
+		t.Fatal("Update should have succeeded on the second attempt: ", err, d.name)
+	}
+}
+
+func TestWeakETags(t *testing.T) {
+	d := &documentStore{name: "a", weak: true}
+	client, done := newDocumentClient(d)
+	defer done()
+	etags := NewETagTracker()
+	client.Use(etags.Middleware())
+
+	client.Get(&Params{Path: "doc"})
+	u, _ := url.Parse(client.BaseUrl().String() + "/doc")
+	if etags.ETag(u) != "" {
+		t.Fatal("Weak ETag should not be remembered: ", etags.ETag(u))
+	}
+	client.Put(&Params{Path: "doc", Body: genericThing{Name: "b"}})
+	if d.ifMatch[0] != "" {
+		t.Fatal("Weak ETag should not be sent with If-Match: ", d.ifMatch)
+	}
+
+	_, _, err := ReadModifyWrite(client, "PUT", &Params{Path: "doc"}, 3, func(thing *genericThing) error {
+		return nil
+	})
+	if err == nil || len(d.ifMatch) != 1 {
+		t.Fatal("A resource with a weak ETag should not be written: ", err, d.ifMatch)
+	}
+}
@@ -0,0 +1,375 @@
+package grestclient
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//DefaultEventRetry is how long an EventStream waits before reconnecting
+//when the server hasn't sent a retry field.
+var DefaultEventRetry = 3 * time.Second
+
+//DefaultMaxEventLineSize is the longest line, a data line for example,
+//an EventStream reads when its MaxLineSize isn't set.
+var DefaultMaxEventLineSize = 1 << 20
+
+//Event is a server-sent event.
+type Event struct {
+	//ID is the last event id seen, which is sent back in the Last-Event-ID
+	//header when reconnecting.
+	ID string
+	//Type is the event field, "message" if the server didn't send one.
+	Type string
+	//Data holds the data lines joined with newlines.
+	Data string
+	//Retry is the reconnection time sent with the event, 0 if none.
+	Retry time.Duration
+}
+
+//EventStream reads server-sent events from a text/event-stream response
+//and reconnects when the connection drops, sending the Last-Event-ID and
+//waiting the retry interval the server asked for.
+//
+//	stream, err := c.Events(&Params{Path: "updates"})
+//	if err != nil {
+//		return err
+//	}
+//	defer stream.Close()
+//	for stream.Next() {
+//		e := stream.Event()
+//		...
+//	}
+//	return stream.Err()
+//
+//It stops when Params.Context is done, Close is called, the server
+//answers a reconnect with 204 No Content, MaxReconnects is reached or a
+//line is longer than MaxLineSize.
+type EventStream struct {
+	//MaxReconnects limits how many times in a row the stream reconnects
+	//without receiving an event. 0 means there is no limit and a negative
+	//value turns reconnecting off.
+	MaxReconnects int
+
+	//MaxLineSize is the longest line read, DefaultMaxEventLineSize if it
+	//is 0. A longer line ends the stream with an error wrapping
+	//bufio.ErrTooLong, since reconnecting would only get it again.
+	MaxLineSize int
+
+	client *Client
+	params Params
+	ctx    context.Context
+
+	mu      sync.Mutex
+	body    io.ReadCloser
+	scanner *bufio.Scanner
+	sized   bool
+	closed  chan struct{}
+	once    sync.Once
+
+	event      Event
+	lastID     string
+	retry      time.Duration
+	reconnects int
+	err        error
+	done       bool
+}
+
+//Events performs a GET for a text/event-stream and returns a stream of
+//its events. The request goes through the client's base url, default
+//headers and query and RequestMutators like any other. The UnmarshalMap
+//is not used.
+//An error is returned if the first connection fails or the response is
+//not a 200 with a text/event-stream Content-Type.
+func (c *Client) Events(p *Params) (*EventStream, error) {
+	s := &EventStream{
+		client: c,
+		params: *p,
+		ctx:    p.context(),
+		closed: make(chan struct{}),
+		retry:  DefaultEventRetry,
+	}
+	s.params.UnmarshalMap = nil
+	s.params.fallback = nil
+	s.params.KeepBodyOpen = true
+
+	if err := s.connect(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+//Next waits for the next event, returning false when the stream has
+//ended. Check Err afterwards.
+func (s *EventStream) Next() bool {
+	for !s.done {
+		if s.scanner != nil {
+			if e, ok := s.readEvent(); ok {
+				s.event = e
+				s.reconnects = 0
+				return true
+			}
+			if errors.Is(s.err, bufio.ErrTooLong) {
+				s.stop(s.err)
+				break
+			}
+		}
+		s.reconnect()
+	}
+	return false
+}
+
+//Event returns the event read by the last call to Next.
+func (s *EventStream) Event() Event {
+	return s.event
+}
+
+//LastEventID returns the id sent with the Last-Event-ID header when
+//reconnecting.
+func (s *EventStream) LastEventID() string {
+	return s.lastID
+}
+
+//Err returns the error that ended the stream, if any. It is nil if the
+//stream was closed or the server ended it with 204 No Content and an
+//ErrCanceled error if the Context was done.
+func (s *EventStream) Err() error {
+	return s.err
+}
+
+//Close ends the stream. It can be called from another goroutine to stop
+//a Next that is waiting for an event.
+func (s *EventStream) Close() error {
+	s.once.Do(func() { close(s.closed) })
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.body != nil {
+		err := s.body.Close()
+		s.body = nil
+		return err
+	}
+	return nil
+}
+
+func (s *EventStream) isClosed() bool {
+	select {
+	case <-s.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *EventStream) stop(err error) {
+	s.done = true
+	s.err = err
+	s.scanner = nil
+	s.Close()
+}
+
+//reconnect waits the retry interval and connects again, ending the
+//stream if it shouldn't or can't.
+func (s *EventStream) reconnect() {
+	s.mu.Lock()
+	if s.body != nil {
+		s.body.Close()
+		s.body = nil
+	}
+	s.mu.Unlock()
+	s.scanner = nil
+
+	if s.isClosed() {
+		s.stop(nil)
+		return
+	}
+	if err := canceled(s.ctx, nil); err != nil {
+		s.stop(err)
+		return
+	}
+	if s.MaxReconnects < 0 || (s.MaxReconnects > 0 && s.reconnects >= s.MaxReconnects) {
+		s.stop(s.err)
+		return
+	}
+	s.reconnects++
+
+	timer := time.NewTimer(s.retry)
+	select {
+	case <-s.closed:
+		timer.Stop()
+		s.stop(nil)
+		return
+	case <-s.ctx.Done():
+		timer.Stop()
+		s.stop(canceled(s.ctx, nil))
+		return
+	case <-timer.C:
+	}
+
+	if err := s.connect(); err != nil {
+		var httpErr *HTTPError
+		if errors.As(err, &httpErr) || errors.Is(err, errNoContent) || errors.Is(err, ErrCanceled) {
+			if errors.Is(err, errNoContent) {
+				err = nil
+			}
+			s.stop(err)
+			return
+		}
+		//keep the error in case this was the last try
+		s.err = err
+	}
+}
+
+var errNoContent = errors.New("grestclient: event stream ended with 204 No Content")
+
+func (s *EventStream) connect() error {
+	p := s.params
+	p.Headers = headerCopy(p.Headers)
+	if p.Headers == nil {
+		p.Headers = make(http.Header)
+	}
+	p.Headers.Set("Accept", "text/event-stream")
+	p.Headers.Set("Cache-Control", "no-cache")
+	if s.lastID != "" {
+		p.Headers.Set("Last-Event-ID", s.lastID)
+	}
+
+	res, err := s.client.Do("GET", &p)
+	if err != nil {
+		if res != nil {
+			res.Body.Close()
+		}
+		return err
+	}
+
+	if res.StatusCode == http.StatusNoContent {
+		res.Body.Close()
+		return errNoContent
+	}
+	mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	if res.StatusCode != http.StatusOK || mediaType != "text/event-stream" {
+		defer res.Body.Close()
+		body, _ := ioutil.ReadAll(io.LimitReader(res.Body, ErrorBodySnapshotSize))
+		return newHTTPError(res.Request, res, body, nil)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.isClosed() {
+		res.Body.Close()
+		return nil
+	}
+	s.body = res.Body
+	s.scanner = bufio.NewScanner(res.Body)
+	s.scanner.Split(scanEventLines)
+	s.sized = false
+	s.err = nil
+	return nil
+}
+
+//readEvent reads lines until an event is complete. ok is false when the
+//connection ended first.
+func (s *EventStream) readEvent() (Event, bool) {
+	//sized here rather than in connect so MaxLineSize can be set after
+	//Events returns
+	if !s.sized {
+		s.scanner.Buffer(nil, s.maxLineSize())
+		s.sized = true
+	}
+
+	var data bytes.Buffer
+	var hasData bool
+	e := Event{}
+
+	for s.scanner.Scan() {
+		line := s.scanner.Text()
+		if line == "" {
+			if !hasData {
+				e = Event{}
+				continue
+			}
+			e.ID = s.lastID
+			if e.Type == "" {
+				e.Type = "message"
+			}
+			e.Data = data.String()
+			return e, true
+		}
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		field, value := line, ""
+		if i := strings.IndexByte(line, ':'); i >= 0 {
+			field, value = line[:i], strings.TrimPrefix(line[i+1:], " ")
+		}
+
+		switch field {
+		case "event":
+			e.Type = value
+		case "data":
+			if hasData {
+				data.WriteByte('\n')
+			}
+			data.WriteString(value)
+			hasData = true
+		case "id":
+			if !strings.ContainsRune(value, 0) {
+				s.lastID = value
+			}
+		case "retry":
+			if ms, err := strconv.Atoi(value); err == nil && ms >= 0 {
+				s.retry = time.Duration(ms) * time.Millisecond
+				e.Retry = s.retry
+			}
+		}
+	}
+
+	if err := s.scanner.Err(); err != nil && !s.isClosed() {
+		if errors.Is(err, bufio.ErrTooLong) {
+			err = fmt.Errorf("grestclient: event stream line longer than %d bytes: %w", s.maxLineSize(), err)
+		}
+		s.err = canceled(s.ctx, err)
+	}
+	return Event{}, false
+}
+
+func (s *EventStream) maxLineSize() int {
+	if s.MaxLineSize > 0 {
+		return s.MaxLineSize
+	}
+	return DefaultMaxEventLineSize
+}
+
+//scanEventLines splits lines ending in \r\n, \n or \r.
+func scanEventLines(data []byte, atEOF bool) (int, []byte, error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		if data[i] == '\r' {
+			if i+1 == len(data) && !atEOF {
+				//need more data to know if this is \r\n
+				return 0, nil, nil
+			}
+			if i+1 < len(data) && data[i+1] == '\n' {
+				return i + 2, data[:i], nil
+			}
+		}
+		return i + 1, data[:i], nil
+	}
+	if atEOF {
+		//an unfinished line at the end of the stream is dropped
+		return len(data), nil, nil
+	}
+	return 0, nil, nil
+}
@@ -0,0 +1,196 @@
+package grestclient
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventsParsesFrames(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Accept") != "text/event-stream" {
+			t.Fatal("Unexpected Accept: ", req.Header.Get("Accept"))
+		}
+		if req.Header.Get("X-Default") != "default" {
+			t.Fatal("Default headers were not sent.")
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, ": comment\n\n")
+		fmt.Fprint(w, "event: update\r\ndata: line one\r\ndata: line two\r\nid: 1\r\n\r\n")
+		fmt.Fprint(w, "data:no space\nretry: 10\n\n")
+	}))
+	defer server.Close()
+
+	base, err := url.Parse(server.URL)
+	client, err := New(base)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Headers().Set("X-Default", "default")
+
+	stream, err := client.Events(&Params{Path: "events"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream.MaxReconnects = -1
+	defer stream.Close()
+
+	var events []Event
+	for stream.Next() {
+		events = append(events, stream.Event())
+	}
+	if err := stream.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 {
+		t.Fatal("Expected 2 events but got: ", events)
+	}
+	if e := events[0]; e.Type != "update" || e.Data != "line one\nline two" || e.ID != "1" {
+		t.Fatal("Unexpected first event: ", e)
+	}
+	if e := events[1]; e.Type != "message" || e.Data != "no space" || e.ID != "1" || e.Retry != 10*time.Millisecond {
+		t.Fatal("Unexpected second event: ", e)
+	}
+}
+
+func TestEventsReconnectWithLastEventID(t *testing.T) {
+	connections := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		connections++
+		switch connections {
+		case 1:
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, "retry: 1\nid: 41\ndata: first\n\n")
+		case 2:
+			if req.Header.Get("Last-Event-ID") != "41" {
+				t.Fatal("Expected Last-Event-ID 41 but got: ", req.Header.Get("Last-Event-ID"))
+			}
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, "id: 42\ndata: second\n\n")
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	base, err := url.Parse(server.URL)
+	client, err := New(base)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stream, err := client.Events(&Params{Path: "events"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+
+	var data []string
+	for stream.Next() {
+		data = append(data, stream.Event().Data)
+	}
+	if err := stream.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 2 || data[1] != "second" || connections != 3 {
+		t.Fatal("Unexpected events: ", data, connections)
+	}
+}
+
+func TestEventsStopOnCancel(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: hello\n\n")
+		w.(http.Flusher).Flush()
+		<-req.Context().Done()
+	}))
+	defer server.Close()
+
+	base, err := url.Parse(server.URL)
+	client, err := New(base)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := client.Events(&Params{Path: "events", Context: ctx})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+
+	if !stream.Next() {
+		t.Fatal("Expected an event: ", stream.Err())
+	}
+	cancel()
+	if stream.Next() {
+		t.Fatal("Did not expect an event after canceling.")
+	}
+	if !errors.Is(stream.Err(), ErrCanceled) {
+		t.Fatal("Expected a canceled error but got: ", stream.Err())
+	}
+}
+
+func TestEventsRejectsOtherContentTypes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("{}"))
+	}))
+	defer server.Close()
+
+	base, err := url.Parse(server.URL)
+	client, err := New(base)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = client.Events(&Params{Path: "events"}); err == nil {
+		t.Fatal("Expected an error for a response that isn't an event stream.")
+	}
+}
+
+func TestEventsStopOnTooLongLine(t *testing.T) {
+	connects := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		connects++
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: short\n\n")
+		fmt.Fprint(w, "data: "+strings.Repeat("x", 200)+"\n\n")
+		fmt.Fprint(w, "data: never\n\n")
+	}))
+	defer server.Close()
+
+	base, _ := url.Parse(server.URL)
+	client, _ := New(base)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stream, err := client.Events(&Params{Context: ctx})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream.MaxLineSize = 100
+	defer stream.Close()
+
+	var events []Event
+	for stream.Next() {
+		events = append(events, stream.Event())
+	}
+	if !errors.Is(stream.Err(), bufio.ErrTooLong) || errors.Is(stream.Err(), ErrCanceled) {
+		t.Fatal("Expected the stream to end with a too long line: ", stream.Err())
+	}
+	if len(events) != 1 || events[0].Data != "short" || connects != 1 {
+		t.Fatal("Stream should end without reconnecting: ", events, connects)
+	}
+}
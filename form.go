@@ -0,0 +1,277 @@
+package grestclient
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	rt "reflect"
+	"strconv"
+	"strings"
+)
+
+//FormContentType is the media type of url encoded form bodies.
+const FormContentType = "application/x-www-form-urlencoded"
+
+//FormMarshalerFunc marshals v into an application/x-www-form-urlencoded
+//body. v can be url.Values, map[string]string, map[string][]string or a
+//struct (or pointer to one).
+//
+//Struct fields are named with a form tag, `form:"name"`, or use the
+//field name if there isn't one. `form:"-"` skips a field and
+//`form:"name,omitempty"` skips it when it has its zero value.
+//Fields can be strings, bools, numbers, encoding.TextMarshalers or
+//slices of those, which send one value per element.
+func FormMarshalerFunc(v interface{}) (ReadLener, error) {
+	values, err := formValues(v)
+	if err != nil {
+		return nil, err
+	}
+	return StringToReadLener(values.Encode()), nil
+}
+
+//FormUnmarshalerFunc unmarshals an application/x-www-form-urlencoded body
+//into v which can be a *url.Values, *map[string]string,
+//*map[string][]string or a pointer to a struct using the same
+//form tags as FormMarshalerFunc.
+func FormUnmarshalerFunc(b []byte, v interface{}) error {
+	values, err := url.ParseQuery(string(b))
+	if err != nil {
+		return err
+	}
+
+	switch t := v.(type) {
+	case *url.Values:
+		*t = values
+		return nil
+	case *map[string][]string:
+		*t = values
+		return nil
+	case *map[string]string:
+		m := make(map[string]string, len(values))
+		for k := range values {
+			m[k] = values.Get(k)
+		}
+		*t = m
+		return nil
+	}
+
+	rv := rt.ValueOf(v)
+	if rv.Kind() != rt.Ptr || rv.IsNil() || rv.Elem().Kind() != rt.Struct {
+		return errors.New("You must pass a pointer to url.Values, a map or a struct to unmarshal a form into.")
+	}
+	return formDecodeStruct(values, rv.Elem())
+}
+
+//FormContentTypeMutator sets the Content-Type of the request to be
+//application/x-www-form-urlencoded
+func FormContentTypeMutator(r *http.Request) error {
+	r.Header.Add("Content-Type", FormContentType)
+	return nil
+}
+
+//SetupForForm is a convenience method that sets the
+//marshaler and unmarshaler funcs on the client to be the
+//Form funcs in this package. It also sets the default
+//Content-Type header to a url encoded form.
+func SetupForForm(c *Client) {
+	c.SetMarshaler(FormMarshalerFunc)
+	c.SetUnmarshaler(FormUnmarshalerFunc)
+	setDefaultHeaders(c, FormContentType, "")
+}
+
+func formValues(v interface{}) (url.Values, error) {
+	switch t := v.(type) {
+	case url.Values:
+		return t, nil
+	case map[string][]string:
+		return url.Values(t), nil
+	case map[string]string:
+		values := make(url.Values, len(t))
+		for k, s := range t {
+			values.Set(k, s)
+		}
+		return values, nil
+	}
+
+	rv := rt.ValueOf(v)
+	for rv.Kind() == rt.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != rt.Struct {
+		return nil, fmt.Errorf("Did not know how to use %T as a form.", v)
+	}
+
+	values := make(url.Values)
+	rtype := rv.Type()
+	for i := 0; i < rtype.NumField(); i++ {
+		field := rtype.Field(i)
+		name, omitEmpty, ok := formField(field)
+		if !ok {
+			continue
+		}
+		fv := rv.Field(i)
+		if omitEmpty && fv.IsZero() {
+			continue
+		}
+		for fv.Kind() == rt.Ptr {
+			if fv.IsNil() {
+				break
+			}
+			fv = fv.Elem()
+		}
+		if fv.Kind() == rt.Ptr {
+			continue
+		}
+
+		if fv.Kind() == rt.Slice && fv.Type().Elem().Kind() != rt.Uint8 {
+			for j := 0; j < fv.Len(); j++ {
+				s, err := formString(fv.Index(j))
+				if err != nil {
+					return nil, fmt.Errorf("form field %s: %v", name, err)
+				}
+				values.Add(name, s)
+			}
+			continue
+		}
+
+		s, err := formString(fv)
+		if err != nil {
+			return nil, fmt.Errorf("form field %s: %v", name, err)
+		}
+		values.Add(name, s)
+	}
+	return values, nil
+}
+
+//formField returns the name used for a struct field in a form and
+//whether it has omitempty. ok is false if the field shouldn't be used.
+func formField(field rt.StructField) (name string, omitEmpty bool, ok bool) {
+	if field.PkgPath != "" {
+		return "", false, false
+	}
+	tag := field.Tag.Get("form")
+	if tag == "-" {
+		return "", false, false
+	}
+	name = field.Name
+	parts := strings.Split(tag, ",")
+	if parts[0] != "" {
+		name = parts[0]
+	}
+	for _, opt := range parts[1:] {
+		if opt == "omitempty" {
+			omitEmpty = true
+		}
+	}
+	return name, omitEmpty, true
+}
+
+func formString(v rt.Value) (string, error) {
+	if v.CanInterface() {
+		if m, ok := v.Interface().(encoding.TextMarshaler); ok {
+			b, err := m.MarshalText()
+			return string(b), err
+		}
+	}
+	switch v.Kind() {
+	case rt.String:
+		return v.String(), nil
+	case rt.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case rt.Int, rt.Int8, rt.Int16, rt.Int32, rt.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case rt.Uint, rt.Uint8, rt.Uint16, rt.Uint32, rt.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case rt.Float32, rt.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, v.Type().Bits()), nil
+	case rt.Slice:
+		if v.Type().Elem().Kind() == rt.Uint8 {
+			return string(v.Bytes()), nil
+		}
+	}
+	return "", fmt.Errorf("unsupported type %s", v.Type())
+}
+
+func formDecodeStruct(values url.Values, rv rt.Value) error {
+	rtype := rv.Type()
+	for i := 0; i < rtype.NumField(); i++ {
+		name, _, ok := formField(rtype.Field(i))
+		if !ok {
+			continue
+		}
+		vals, ok := values[name]
+		if !ok || len(vals) == 0 {
+			continue
+		}
+		fv := rv.Field(i)
+		if fv.Kind() == rt.Ptr {
+			if fv.IsNil() {
+				fv.Set(rt.New(fv.Type().Elem()))
+			}
+			fv = fv.Elem()
+		}
+
+		if fv.Kind() == rt.Slice && fv.Type().Elem().Kind() != rt.Uint8 {
+			slice := rt.MakeSlice(fv.Type(), len(vals), len(vals))
+			for j, s := range vals {
+				if err := formSet(slice.Index(j), s); err != nil {
+					return fmt.Errorf("form field %s: %v", name, err)
+				}
+			}
+			fv.Set(slice)
+			continue
+		}
+
+		if err := formSet(fv, vals[0]); err != nil {
+			return fmt.Errorf("form field %s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+func formSet(v rt.Value, s string) error {
+	if v.CanAddr() {
+		if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+			return u.UnmarshalText([]byte(s))
+		}
+	}
+	switch v.Kind() {
+	case rt.String:
+		v.SetString(s)
+	case rt.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case rt.Int, rt.Int8, rt.Int16, rt.Int32, rt.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case rt.Uint, rt.Uint8, rt.Uint16, rt.Uint32, rt.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case rt.Float32, rt.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case rt.Slice:
+		if v.Type().Elem().Kind() == rt.Uint8 {
+			v.SetBytes([]byte(s))
+			return nil
+		}
+		fallthrough
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package grestclient
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+type formToken struct {
+	GrantType string   `form:"grant_type"`
+	Scope     []string `form:"scope"`
+	ClientID  string   `form:"client_id,omitempty"`
+	Retries   int      `form:"retries"`
+	Ignored   string   `form:"-"`
+}
+
+func TestFormMarshalers(t *testing.T) {
+	r, err := FormMarshalerFunc(formToken{
+		GrantType: "client_credentials",
+		Scope:     []string{"read", "write"},
+		Retries:   2,
+		Ignored:   "nope",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadAll(r)
+	if string(b) != "grant_type=client_credentials&retries=2&scope=read&scope=write" {
+		t.Fatal("Unexpected form: ", string(b))
+	}
+
+	var result formToken
+	if err = FormUnmarshalerFunc(b, &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.GrantType != "client_credentials" || len(result.Scope) != 2 || result.Retries != 2 {
+		t.Fatal("Form was not unmarshaled: ", result)
+	}
+
+	var values url.Values
+	if err = FormUnmarshalerFunc(b, &values); err != nil {
+		t.Fatal(err)
+	}
+	if values.Get("grant_type") != "client_credentials" {
+		t.Fatal("Form was not unmarshaled into url.Values: ", values)
+	}
+
+	if _, err = FormMarshalerFunc(42); err == nil {
+		t.Fatal("Expected an error for a value that can't be a form.")
+	}
+}
+
+func TestSetupForForm(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Content-Type") != FormContentType {
+			t.Fatal("Unexpected Content-Type: ", req.Header.Get("Content-Type"))
+		}
+		if err := req.ParseForm(); err != nil {
+			t.Fatal(err)
+		}
+		if req.PostForm.Get("username") != "me" {
+			t.Fatal("Form was not sent: ", req.PostForm.Encode())
+		}
+		w.Write([]byte("ok=true"))
+	}))
+	defer server.Close()
+
+	base, err := url.Parse(server.URL)
+	client, err := New(base)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetupForForm(client)
+
+	var success map[string]string
+	_, err = client.Post(&Params{
+		Path:         "token",
+		Body:         map[string]string{"username": "me"},
+		UnmarshalMap: UnmarshalMap{200: &success},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if success["ok"] != "true" {
+		t.Fatal("Response was not unmarshaled: ", success)
+	}
+}
+
+func TestSetupForXml(t *testing.T) {
+	type envelope struct {
+		XMLName xml.Name `xml:"envelope"`
+		Body    string   `xml:"body"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Content-Type") != "application/xml" {
+			t.Fatal("Unexpected Content-Type: ", req.Header.Get("Content-Type"))
+		}
+		b, _ := ioutil.ReadAll(req.Body)
+		if string(b) != "<envelope><body>ping</body></envelope>" {
+			t.Fatal("Unexpected body: ", string(b))
+		}
+		w.Write([]byte("<envelope><body>pong</body></envelope>"))
+	}))
+	defer server.Close()
+
+	base, err := url.Parse(server.URL)
+	client, err := New(base)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetupForXml(client)
+
+	var success envelope
+	_, err = client.Post(&Params{
+		Path:         "soap",
+		Body:         envelope{Body: "ping"},
+		UnmarshalMap: UnmarshalMap{200: &success},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if success.Body != "pong" {
+		t.Fatal("Response was not unmarshaled: ", success)
+	}
+}
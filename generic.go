@@ -0,0 +1,129 @@
+package grestclient
+
+import (
+	"net/http"
+)
+
+//DoAs performs a request like Client.Do and unmarshals successful
+//responses into a new T which is returned. A response is successful when
+//its status is inside the client's SuccessRange, or DefaultSuccessRange
+//if none is set. Entries in p.UnmarshalMap still take precedence, so you
+//can keep decoding error bodies into your own destinations.
+//The client's unmarshaler is used, so a client set up with SetupForJson
+//decodes json and the default client decodes text into a string T.
+func DoAs[T any](c *Client, method string, p *Params) (T, *http.Response, error) {
+	var success T
+	req := *p
+	req.fallback = func(status int) interface{} {
+		if c.successful(status) {
+			return &success
+		}
+		return nil
+	}
+	res, err := c.Do(method, &req)
+	return success, res, err
+}
+
+//Result holds the decoded body of a response. Success is populated
+//for successful responses and Error for everything else.
+type Result[S, E any] struct {
+	Success  S
+	Error    E
+	Response *http.Response
+
+	successful bool
+}
+
+//Failed reports whether the response was not successful, meaning Error
+//was populated instead of Success.
+func (r *Result[S, E]) Failed() bool {
+	return !r.successful
+}
+
+//DoResult performs a request like Client.Do and unmarshals successful
+//responses into Success and every other response into Error.
+//If the client has a SuccessRange set the *HTTPError is returned
+//along with the Result.
+func DoResult[S, E any](c *Client, method string, p *Params) (*Result[S, E], error) {
+	result := &Result[S, E]{}
+	req := *p
+	req.fallback = func(status int) interface{} {
+		if c.successful(status) {
+			return &result.Success
+		}
+		return &result.Error
+	}
+	res, err := c.Do(method, &req)
+	result.Response = res
+	result.successful = res != nil && c.successful(res.StatusCode)
+	return result, err
+}
+
+//GetJSON performs a GET and decodes a successful json response into T.
+//The client's marshaler and unmarshaler are ignored in favor of the
+//Json funcs but everything else about the client is used.
+func GetJSON[T any](c *Client, p *Params) (T, *http.Response, error) {
+	return DoAs[T](jsonClient(c), "GET", jsonParams(c, p))
+}
+
+//PostJSON performs a POST with p.Body marshaled as json and decodes a
+//successful json response into T.
+func PostJSON[T any](c *Client, p *Params) (T, *http.Response, error) {
+	return DoAs[T](jsonClient(c), "POST", jsonParams(c, p))
+}
+
+//PutJSON performs a PUT with p.Body marshaled as json and decodes a
+//successful json response into T.
+func PutJSON[T any](c *Client, p *Params) (T, *http.Response, error) {
+	return DoAs[T](jsonClient(c), "PUT", jsonParams(c, p))
+}
+
+//PatchJSON performs a PATCH with p.Body marshaled as json and decodes a
+//successful json response into T.
+func PatchJSON[T any](c *Client, p *Params) (T, *http.Response, error) {
+	return DoAs[T](jsonClient(c), "PATCH", jsonParams(c, p))
+}
+
+//DeleteJSON performs a DELETE and decodes a successful json response into T.
+func DeleteJSON[T any](c *Client, p *Params) (T, *http.Response, error) {
+	return DoAs[T](jsonClient(c), "DELETE", jsonParams(c, p))
+}
+
+//successful reports whether status is inside the client's SuccessRange
+//or DefaultSuccessRange when there is none.
+func (c *Client) successful(status int) bool {
+	r := c.SuccessRange()
+	if r == nil {
+		r = DefaultSuccessRange
+	}
+	return r.Contains(status)
+}
+
+//jsonClient returns a clone of c that uses the Json (un)marshalers.
+func jsonClient(c *Client) *Client {
+	jc := c.Clone()
+	jc.SetMarshaler(JsonMarshalerFunc)
+	jc.SetUnmarshaler(JsonUnmarshalerFunc)
+	return jc
+}
+
+//jsonParams returns a copy of p that asks for json and labels its body,
+//if it has one, as json unless the client or p already set those headers.
+func jsonParams(c *Client, p *Params) *Params {
+	headers := c.snapshot().headers
+	req := *p
+	req.Headers = headerCopy(p.Headers)
+	if req.Headers == nil {
+		req.Headers = make(http.Header)
+	}
+	names := []string{"Accept"}
+	if p.Body != nil {
+		names = append(names, "Content-Type")
+	}
+	for _, name := range names {
+		if req.Headers.Get(name) == "" && headers.Get(name) == "" {
+			req.Headers.Set(name, "application/json")
+		}
+	}
+	return &req
+}
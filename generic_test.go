@@ -0,0 +1,131 @@
+package grestclient
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+type genericThing struct {
+	Name string `json:"name"`
+}
+
+type genericProblem struct {
+	Message string `json:"message"`
+}
+
+func TestGetJSON(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Accept") != "application/json" {
+			t.Fatal("Expected json to be accepted but got: ", req.Header.Get("Accept"))
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"name":"thing"}`))
+	}))
+	defer server.Close()
+
+	base, err := url.Parse(server.URL)
+	client, err := New(base)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	thing, res, err := GetJSON[genericThing](client, &Params{Path: "thing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusCreated {
+		t.Fatal("Unexpected status code: ", res.StatusCode)
+	}
+	if thing.Name != "thing" {
+		t.Fatal("Did not decode the response: ", thing)
+	}
+}
+
+func TestPostJSONMarshalsBody(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Content-Type") != "application/json" {
+			t.Fatal("Unexpected Content-Type: ", req.Header.Get("Content-Type"))
+		}
+		var in genericThing
+		b, _ := ioutil.ReadAll(req.Body)
+		if err := json.Unmarshal(b, &in); err != nil {
+			t.Fatal(err)
+		}
+		in.Name += "-result"
+		b, _ = json.Marshal(in)
+		w.Write(b)
+	}))
+	defer server.Close()
+
+	base, err := url.Parse(server.URL)
+	client, err := New(base)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	thing, _, err := PostJSON[genericThing](client, &Params{Path: "thing", Body: genericThing{Name: "test"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if thing.Name != "test-result" {
+		t.Fatal("Did not decode the response: ", thing)
+	}
+	if client.marshaler != nil || client.unmarshaler != nil {
+		t.Fatal("The client passed in should not be changed.")
+	}
+}
+
+func TestDoResultDecodesError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"message":"bad"}`))
+	}))
+	defer server.Close()
+
+	base, err := url.Parse(server.URL)
+	client, err := New(base)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetupForJson(client)
+
+	result, err := DoResult[genericThing, genericProblem](client, "GET", &Params{Path: "thing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Failed() {
+		t.Fatal("Expected the result to have failed.")
+	}
+	if result.Error.Message != "bad" || result.Success.Name != "" {
+		t.Fatal("Unexpected result: ", result.Success, result.Error)
+	}
+}
+
+func TestDoAsWithStringUnmarshaler(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("world"))
+	}))
+	defer server.Close()
+
+	base, err := url.Parse(server.URL)
+	client, err := New(base)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, _, err := DoAs[string](client, "GET", &Params{Path: "hello"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != "world" {
+		t.Fatal("Unexpected result: ", s)
+	}
+}
@@ -1,12 +1,15 @@
 package grestclient
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"testing"
+	"time"
 )
 
 func TestMeetsInterface(t *testing.T) {
@@ -546,6 +549,32 @@ func TestJsonMarshaledBody(t *testing.T) {
 	}
 }
 
+func TestUnmarshalErrorReturned(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("not json"))
+	}))
+	defer server.Close()
+
+	base, err := url.Parse(server.URL)
+	client, err := New(base)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.SetUnmarshaler(JsonUnmarshalerFunc)
+
+	var result struct{ Name string }
+	res, err := client.Get(&Params{Path: "get", UnmarshalMap: UnmarshalMap{200: &result}})
+
+	var syntaxErr *json.SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		t.Fatal("Expected the unmarshaling error: ", err)
+	}
+	if res == nil || res.StatusCode != http.StatusOK {
+		t.Fatal("The response should be returned with the error: ", res)
+	}
+}
+
 func TestCloneClient(t *testing.T) {
 	originalRequest := 0
 	cloneRequest := 0
@@ -617,3 +646,182 @@ func TestPathIsConcatenated(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestContextCanceledBeforeRequest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		t.Fatal("Did not expect the request to reach the server.")
+	}))
+	defer server.Close()
+
+	base, err := url.Parse(server.URL)
+	client, err := New(base)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	res, err := client.Get(&Params{Path: "get", Context: ctx})
+	if !errors.Is(err, ErrCanceled) || !errors.Is(err, context.Canceled) {
+		t.Fatal("Expected a canceled error but got: ", err)
+	}
+	if res != nil {
+		t.Fatal("Expected response to be nil.")
+	}
+}
+
+func TestContextDeadlineExceeded(t *testing.T) {
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		select {
+		case <-done:
+		case <-req.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(done)
+
+	base, err := url.Parse(server.URL)
+	client, err := New(base)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err = client.Get(&Params{Path: "get", Context: ctx})
+	if !errors.Is(err, ErrCanceled) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal("Expected a deadline exceeded error but got: ", err)
+	}
+}
+
+func TestContextVisibleToRequestMutators(t *testing.T) {
+	type key struct{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	defer server.Close()
+
+	base, err := url.Parse(server.URL)
+	client, err := New(base)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client.AddRequestMutators(func(r *http.Request) error {
+		if r.Context().Value(key{}) != "value" {
+			t.Fatal("Request mutator did not see the request context.")
+		}
+		return nil
+	})
+
+	_, err = client.Get(&Params{
+		Path:    "get",
+		Context: context.WithValue(context.Background(), key{}, "value"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDoCustomMethod(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != "PROPFIND" {
+			t.Fatal("Expected PROPFIND but got: ", req.Method)
+		}
+		if req.URL.Path != "/dav" {
+			t.Fatal("Expected path to be dav but got: ", req.URL.Path)
+		}
+		if req.Header.Get("Depth") != "1" {
+			t.Fatal("Did not receive one off header.")
+		}
+		b, _ := ioutil.ReadAll(req.Body)
+		if string(b) != "props" {
+			t.Fatal("Incorrect body sent: ", string(b))
+		}
+		w.Write([]byte("multistatus"))
+	}))
+	defer server.Close()
+
+	base, err := url.Parse(server.URL)
+	client, err := New(base)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var success string
+	_, err = client.Do("PROPFIND", &Params{
+		Path:         "dav",
+		Headers:      http.Header{"Depth": []string{"1"}},
+		Body:         "props",
+		UnmarshalMap: UnmarshalMap{200: &success},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if success != "multistatus" {
+		t.Fatal("Unmarshaling didn't work: ", success)
+	}
+}
+
+func TestSendPrebuiltRequest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != "MKCOL" {
+			t.Fatal("Expected MKCOL but got: ", req.Method)
+		}
+		if req.URL.Path != "/base/collection" {
+			t.Fatal("Relative request was not resolved against the base url: ", req.URL.Path)
+		}
+		if req.Header.Get("X-Default") != "default" || req.Header.Get("X-Own") != "own" {
+			t.Fatal("Headers were not merged: ", req.Header)
+		}
+		query := req.URL.Query()
+		if query.Get("default") != "1" || query.Get("own") != "1" || query.Get("param") != "1" {
+			t.Fatal("Query was not merged: ", query.Encode())
+		}
+		if req.Header.Get("X-Mutated") != "yes" {
+			t.Fatal("Request mutator was not run.")
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("created"))
+	}))
+	defer server.Close()
+
+	base, err := url.Parse(server.URL + "/base")
+	client, err := New(base)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Headers().Set("X-Default", "default")
+	client.Query().Set("default", "1")
+	client.AddRequestMutators(func(r *http.Request) error {
+		r.Header.Set("X-Mutated", "yes")
+		return nil
+	})
+
+	r, err := http.NewRequest("MKCOL", "/collection?own=1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set("X-Own", "own")
+
+	var success string
+	res, err := client.Send(r, &Params{
+		Query:        url.Values{"param": []string{"1"}},
+		UnmarshalMap: UnmarshalMap{http.StatusCreated: &success},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusCreated || success != "created" {
+		t.Fatal("Unexpected response: ", res.StatusCode, success)
+	}
+	if r.Header.Get("X-Default") != "" {
+		t.Fatal("The request passed to Send should not be changed.")
+	}
+}
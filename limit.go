@@ -0,0 +1,286 @@
+package grestclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"path"
+	"strconv"
+	"sync"
+	"time"
+)
+
+//ErrRateLimited is returned when a RateLimiter won't let a request
+//through, either because it fails fast or because the request's context
+//would be done before it could go.
+var ErrRateLimited = errors.New("grestclient: rate limited")
+
+//RateLimiter throttles requests with a token bucket and limits how many
+//are in flight at the same time. A request is in flight until its
+//response body is closed.
+//
+//A RateLimiter set on a client is shared by its clones, so they are
+//limited together. Set a new one on a clone to limit it on its own.
+//
+//Every attempt made by a RetryPolicy waits for its own token.
+type RateLimiter struct {
+	//FailFast returns ErrRateLimited instead of waiting for a token or
+	//for a request in flight to finish.
+	FailFast bool
+
+	//Adaptive makes the limiter follow the server's limits. A Retry-After
+	//header on a 429 or 503 and an X-RateLimit-Remaining header of 0 hold
+	//back all requests until the time given by Retry-After or
+	//X-RateLimit-Reset, which can be seconds from now or a unix time.
+	//A lower X-RateLimit-Remaining also caps the tokens left.
+	Adaptive bool
+
+	rate     float64
+	burst    float64
+	inFlight chan struct{}
+
+	mu      sync.Mutex
+	tokens  float64
+	last    time.Time
+	blocked time.Time
+	now     func() time.Time
+}
+
+//NewRateLimiter returns a RateLimiter letting rate requests a second
+//through with bursts of up to burst requests and no more than maxInFlight
+//at the same time. A rate or maxInFlight of 0 or less means no limit and
+//burst defaults to rate rounded up.
+func NewRateLimiter(rate float64, burst int, maxInFlight int) *RateLimiter {
+	l := &RateLimiter{rate: rate, burst: float64(burst), now: time.Now}
+	if l.burst <= 0 {
+		l.burst = math.Max(1, math.Ceil(rate))
+	}
+	l.tokens = l.burst
+	if maxInFlight > 0 {
+		l.inFlight = make(chan struct{}, maxInFlight)
+	}
+	return l
+}
+
+//SetRateLimiter sets the RateLimiter used for requests that don't match
+//a path pattern set with SetPathRateLimiter. Pass nil to remove it.
+func (c *Client) SetRateLimiter(l *RateLimiter) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.limiter = l
+}
+
+//RateLimiter returns the RateLimiter set with SetRateLimiter.
+func (c *Client) RateLimiter() *RateLimiter {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.limiter
+}
+
+//SetPathRateLimiter sets the RateLimiter used for requests whose url path
+//matches pattern, as in path.Match, like "/v1/search/*". Patterns are
+//tried in the order they were first set. Pass a nil limiter to remove
+//the pattern.
+func (c *Client) SetPathRateLimiter(pattern string, l *RateLimiter) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	routes, err := setPathRoute(c.pathLimiters, pattern, l)
+	if err != nil {
+		return err
+	}
+	c.pathLimiters = routes
+	return nil
+}
+
+func (c *Client) limiterFor(r *http.Request) *RateLimiter {
+	if l := matchPathRoute(c.pathLimiters, r.URL.Path); l != nil {
+		return l
+	}
+	return c.limiter
+}
+
+//pathRoute ties something like a RateLimiter to a path.Match pattern.
+type pathRoute[T any] struct {
+	pattern string
+	value   *T
+}
+
+//setPathRoute returns a copy of routes with the value for pattern set to
+//v, or removed if v is nil.
+func setPathRoute[T any](routes []pathRoute[T], pattern string, v *T) ([]pathRoute[T], error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return routes, err
+	}
+	next := make([]pathRoute[T], 0, len(routes)+1)
+	found := false
+	for _, route := range routes {
+		if route.pattern == pattern {
+			found = true
+			if v == nil {
+				continue
+			}
+			route.value = v
+		}
+		next = append(next, route)
+	}
+	if !found && v != nil {
+		next = append(next, pathRoute[T]{pattern, v})
+	}
+	return next, nil
+}
+
+//matchPathRoute returns the value of the first route matching p.
+func matchPathRoute[T any](routes []pathRoute[T], p string) *T {
+	for _, route := range routes {
+		if ok, _ := path.Match(route.pattern, p); ok {
+			return route.value
+		}
+	}
+	return nil
+}
+
+//limit performs r with doer once l lets it through.
+func (l *RateLimiter) limit(doer HttpDoer, r *http.Request) (*http.Response, error) {
+	release, err := l.acquire(r.Context())
+	if err != nil {
+		return nil, err
+	}
+	response, err := doer.Do(r)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	l.observe(response)
+	response.Body = &releaseBody{ReadCloser: response.Body, release: release}
+	return response, nil
+}
+
+//acquire waits for a token and a free slot for a request in flight. The
+//returned func frees the slot.
+func (l *RateLimiter) acquire(ctx context.Context) (func(), error) {
+	if err := l.take(ctx); err != nil {
+		return nil, err
+	}
+	if l.inFlight == nil {
+		return func() {}, nil
+	}
+
+	if l.FailFast {
+		select {
+		case l.inFlight <- struct{}{}:
+		default:
+			return nil, ErrRateLimited
+		}
+	} else {
+		select {
+		case l.inFlight <- struct{}{}:
+		case <-ctx.Done():
+			return nil, canceled(ctx, ctx.Err())
+		}
+	}
+	var once sync.Once
+	return func() {
+		once.Do(func() { <-l.inFlight })
+	}, nil
+}
+
+//take waits for a token.
+func (l *RateLimiter) take(ctx context.Context) error {
+	for {
+		wait := l.reserve()
+		if wait == 0 {
+			return nil
+		}
+		if l.FailFast {
+			return ErrRateLimited
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			return ErrRateLimited
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return canceled(ctx, ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+//reserve takes a token if there is one, otherwise it returns how long
+//to wait before there might be.
+func (l *RateLimiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if now.Before(l.blocked) {
+		return l.blocked.Sub(now)
+	}
+	if l.rate <= 0 {
+		return 0
+	}
+	if !l.last.IsZero() {
+		l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	}
+	l.last = now
+	if l.tokens >= 1 {
+		l.tokens--
+		return 0
+	}
+	return time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+}
+
+//observe follows the limits the server sent in res if l is Adaptive.
+func (l *RateLimiter) observe(res *http.Response) {
+	if !l.Adaptive {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if res.StatusCode == http.StatusTooManyRequests || res.StatusCode == http.StatusServiceUnavailable {
+		if after, ok := retryAfter(res); ok {
+			l.block(now.Add(after))
+		}
+	}
+
+	remaining, err := strconv.Atoi(res.Header.Get("X-RateLimit-Remaining"))
+	if err != nil || remaining < 0 {
+		return
+	}
+	if float64(remaining) < l.tokens {
+		l.tokens = float64(remaining)
+	}
+	if remaining == 0 {
+		if reset, err := strconv.ParseInt(res.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+			//big values are unix times, small ones are seconds from now
+			if reset > 1e9 {
+				l.block(time.Unix(reset, 0))
+			} else {
+				l.block(now.Add(time.Duration(reset) * time.Second))
+			}
+		}
+	}
+}
+
+func (l *RateLimiter) block(until time.Time) {
+	if until.After(l.blocked) {
+		l.blocked = until
+	}
+}
+
+//releaseBody frees a request's slot in a RateLimiter when it is closed.
+type releaseBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releaseBody) Close() error {
+	defer b.release()
+	return b.ReadCloser.Close()
+}
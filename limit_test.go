@@ -0,0 +1,179 @@
+package grestclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterTokenBucket(t *testing.T) {
+	l := NewRateLimiter(10, 2, 0)
+	now := time.Now()
+	l.now = func() time.Time { return now }
+
+	if l.reserve() != 0 || l.reserve() != 0 {
+		t.Fatal("The burst should go through without waiting.")
+	}
+	if wait := l.reserve(); wait != 100*time.Millisecond {
+		t.Fatal("Should wait for the next token: ", wait)
+	}
+
+	now = now.Add(time.Second)
+	if l.reserve() != 0 || l.reserve() != 0 || l.reserve() == 0 {
+		t.Fatal("Tokens should refill up to the burst only.")
+	}
+
+	l.FailFast = true
+	if err := l.take(context.Background()); !errors.Is(err, ErrRateLimited) {
+		t.Fatal("Should have failed fast: ", err)
+	}
+}
+
+func TestRateLimiterFailsWhenContextDeadlineIsTooSoon(t *testing.T) {
+	l := NewRateLimiter(0.1, 1, 0)
+	l.take(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := l.take(ctx); !errors.Is(err, ErrRateLimited) {
+		t.Fatal("Should not wait past the deadline: ", err)
+	}
+	if time.Since(start) > 40*time.Millisecond {
+		t.Fatal("Should have failed without waiting.")
+	}
+}
+
+func TestMaxInFlight(t *testing.T) {
+	var inFlight, most int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			m := atomic.LoadInt32(&most)
+			if n <= m || atomic.CompareAndSwapInt32(&most, m, n) {
+				break
+			}
+		}
+		<-release
+	}))
+	defer server.Close()
+
+	base, _ := url.Parse(server.URL)
+	client, _ := New(base)
+	client.SetHttpDoer(http.DefaultClient)
+	client.SetRateLimiter(NewRateLimiter(0, 0, 2))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			client.Clone().Get(&Params{})
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if most != 2 {
+		t.Fatal("Clones should share the limit of 2 requests in flight, saw: ", most)
+	}
+}
+
+func TestMaxInFlightHoldsKeptBodies(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	defer server.Close()
+
+	base, _ := url.Parse(server.URL)
+	client, _ := New(base)
+	limiter := NewRateLimiter(0, 0, 1)
+	limiter.FailFast = true
+	client.SetRateLimiter(limiter)
+
+	res, err := client.Get(&Params{KeepBodyOpen: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = client.Get(&Params{}); !errors.Is(err, ErrRateLimited) {
+		t.Fatal("The open body should still count as in flight: ", err)
+	}
+	res.Body.Close()
+	if _, err = client.Get(&Params{}); err != nil {
+		t.Fatal("Closing the body should free the slot: ", err)
+	}
+}
+
+func TestPathRateLimiter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	defer server.Close()
+
+	base, _ := url.Parse(server.URL)
+	client, _ := New(base)
+	search := NewRateLimiter(1, 1, 0)
+	search.FailFast = true
+	if err := client.SetPathRateLimiter("/search/*", search); err != nil {
+		t.Fatal(err)
+	}
+
+	client.Get(&Params{Path: "search/a"})
+	if _, err := client.Get(&Params{Path: "search/b"}); !errors.Is(err, ErrRateLimited) {
+		t.Fatal("Search should be limited: ", err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := client.Get(&Params{Path: "items"}); err != nil {
+			t.Fatal("Other paths should not be limited: ", err)
+		}
+	}
+
+	client.SetPathRateLimiter("/search/*", nil)
+	if _, err := client.Get(&Params{Path: "search/c"}); err != nil {
+		t.Fatal("Limiter should have been removed: ", err)
+	}
+}
+
+func TestAdaptiveRateLimiter(t *testing.T) {
+	reset := time.Now().Add(time.Hour).Unix()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/remaining":
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset, 10))
+		case "/busy":
+			w.Header().Set("Retry-After", "120")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer server.Close()
+
+	base, _ := url.Parse(server.URL)
+	client, _ := New(base)
+	limiter := NewRateLimiter(100, 10, 0)
+	limiter.Adaptive = true
+	limiter.FailFast = true
+	client.SetRateLimiter(limiter)
+
+	client.Get(&Params{Path: "remaining"})
+	if _, err := client.Get(&Params{}); !errors.Is(err, ErrRateLimited) {
+		t.Fatal("Should wait for X-RateLimit-Reset: ", err)
+	}
+	if wait := limiter.reserve(); wait < 59*time.Minute {
+		t.Fatal("Should be blocked until the reset: ", wait)
+	}
+
+	other := NewRateLimiter(0, 0, 0)
+	other.Adaptive = true
+	client.SetRateLimiter(other)
+	client.Get(&Params{Path: "busy"})
+	if wait := other.reserve(); wait < 119*time.Second {
+		t.Fatal("Should be blocked for Retry-After: ", wait)
+	}
+}
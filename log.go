@@ -0,0 +1,248 @@
+package grestclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//Redacted replaces the values LoggingMiddleware hides.
+const Redacted = "REDACTED"
+
+//LogOptions configures LoggingMiddleware.
+type LogOptions struct {
+	//Level of the records for requests that got a response. Requests
+	//that failed are logged at slog.LevelError. Defaults to slog.LevelInfo.
+	Level slog.Level
+
+	//Headers are the request and response headers to log.
+	Headers []string
+
+	//RedactHeaders are logged as REDACTED. Defaults to Authorization,
+	//Proxy-Authorization, Cookie and Set-Cookie.
+	RedactHeaders []string
+	//RedactQuery are the query parameters logged as REDACTED. Defaults
+	//to api_key, access_token and token.
+	RedactQuery []string
+	//RedactFields are the json body fields logged as REDACTED, given as
+	//dotted paths like "password" or "user.card.number". A * matches
+	//any field or array index, like "items.*.secret".
+	RedactFields []string
+
+	//MaxBodySize is the most bytes of each body logged. Bodies aren't
+	//logged if it is 0. Json bodies with RedactFields that are bigger are
+	//left out since they can't be redacted. Response bodies are never
+	//logged with Params.KeepBodyOpen so streams aren't held up.
+	MaxBodySize int
+}
+
+//DefaultRedactHeaders are the headers LoggingMiddleware redacts when
+//LogOptions.RedactHeaders isn't set.
+var DefaultRedactHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+//DefaultRedactQuery are the query parameters LoggingMiddleware redacts
+//when LogOptions.RedactQuery isn't set.
+var DefaultRedactQuery = []string{"api_key", "access_token", "token"}
+
+//LoggingMiddleware logs a structured record to h for every request with
+//its method, url, status, duration, sizes, number of attempts and the
+//headers and bodies asked for in opts, hiding what should be redacted.
+//
+//	c.Use(LoggingMiddleware(slog.NewJSONHandler(os.Stderr, nil), LogOptions{
+//		Headers:     []string{"Content-Type", "Authorization"},
+//		MaxBodySize: 1024,
+//	}))
+//
+//Credentials are added after Middleware runs so they only show up in
+//the response, if the server sends them back.
+func LoggingMiddleware(h slog.Handler, opts LogOptions) Middleware {
+	logger := slog.New(h)
+	if opts.RedactHeaders == nil {
+		opts.RedactHeaders = DefaultRedactHeaders
+	}
+	if opts.RedactQuery == nil {
+		opts.RedactQuery = DefaultRedactQuery
+	}
+
+	return func(next Handler) Handler {
+		return func(r *http.Request, p *Params) (*http.Response, error) {
+			ctx := r.Context()
+			if !logger.Enabled(ctx, opts.Level) && !logger.Enabled(ctx, slog.LevelError) {
+				return next(r, p)
+			}
+
+			r, attempts := countAttempts(r)
+			attrs := []slog.Attr{
+				slog.String("method", r.Method),
+				slog.String("url", opts.redactURL(r)),
+			}
+			if r.ContentLength >= 0 {
+				attrs = append(attrs, slog.Int64("request_size", r.ContentLength))
+			}
+			if headers := opts.headers(r.Header); len(headers) > 0 {
+				attrs = append(attrs, slog.Group("request_headers", headers...))
+			}
+			if opts.MaxBodySize > 0 && r.GetBody != nil {
+				if body, err := r.GetBody(); err == nil {
+					attrs = opts.appendBody(attrs, "request_body", r.Header.Get("Content-Type"), body)
+					body.Close()
+				}
+			}
+
+			start := time.Now()
+			response, err := next(r, p)
+			attrs = append(attrs,
+				slog.Duration("duration", time.Since(start)),
+				slog.Int("attempts", *attempts))
+
+			if err != nil {
+				attrs = append(attrs, slog.String("error", err.Error()))
+			}
+			if response == nil {
+				logger.LogAttrs(ctx, slog.LevelError, "http request failed", attrs...)
+				return response, err
+			}
+
+			attrs = append(attrs, slog.Int("status", response.StatusCode))
+			if response.ContentLength >= 0 {
+				attrs = append(attrs, slog.Int64("response_size", response.ContentLength))
+			}
+			if headers := opts.headers(response.Header); len(headers) > 0 {
+				attrs = append(attrs, slog.Group("response_headers", headers...))
+			}
+			if opts.MaxBodySize > 0 && !p.KeepBodyOpen && response.Body != nil {
+				var logged []byte
+				logged, response.Body = peekBody(response.Body, opts.MaxBodySize)
+				attrs = opts.appendBody(attrs, "response_body", response.Header.Get("Content-Type"),
+					ioutil.NopCloser(bytes.NewReader(logged)))
+			}
+
+			level := opts.Level
+			if err != nil {
+				level = slog.LevelError
+			}
+			logger.LogAttrs(ctx, level, "http request", attrs...)
+			return response, err
+		}
+	}
+}
+
+//peekBody reads up to max+1 bytes of body and returns them with a body
+//that still reads from the start.
+func peekBody(body io.ReadCloser, max int) ([]byte, io.ReadCloser) {
+	peeked, _ := ioutil.ReadAll(io.LimitReader(body, int64(max)+1))
+	return peeked, struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(peeked), body), body}
+}
+
+func (o LogOptions) redactURL(r *http.Request) string {
+	return redactURL(r.URL, o.RedactQuery)
+}
+
+//redactURL returns u with its password and the query parameters in names
+//replaced by REDACTED.
+func redactURL(ru *url.URL, names []string) string {
+	u := *ru
+	q := u.Query()
+	changed := false
+	for _, name := range names {
+		for key := range q {
+			if strings.EqualFold(key, name) {
+				q[key] = []string{Redacted}
+				changed = true
+			}
+		}
+	}
+	if changed {
+		u.RawQuery = q.Encode()
+	}
+	return u.Redacted()
+}
+
+func (o LogOptions) headers(h http.Header) []interface{} {
+	var attrs []interface{}
+	for _, name := range o.Headers {
+		values := h.Values(name)
+		if len(values) == 0 {
+			continue
+		}
+		value := strings.Join(values, ", ")
+		for _, redact := range o.RedactHeaders {
+			if strings.EqualFold(name, redact) {
+				value = Redacted
+				break
+			}
+		}
+		attrs = append(attrs, slog.String(http.CanonicalHeaderKey(name), value))
+	}
+	return attrs
+}
+
+//appendBody adds up to MaxBodySize bytes of body to attrs with json
+//fields redacted.
+func (o LogOptions) appendBody(attrs []slog.Attr, key string, contentType string, body io.Reader) []slog.Attr {
+	b, _ := ioutil.ReadAll(io.LimitReader(body, int64(o.MaxBodySize)+1))
+	if len(b) == 0 {
+		return attrs
+	}
+	truncated := len(b) > o.MaxBodySize
+	if truncated {
+		b = b[:o.MaxBodySize]
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	trimmed := bytes.TrimSpace(b)
+	isJson := mediaType == "application/json" || strings.HasSuffix(mediaType, "+json") ||
+		(len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '['))
+	if isJson && len(o.RedactFields) > 0 {
+		if truncated {
+			return append(attrs, slog.String(key, "body bigger than "+strconv.Itoa(o.MaxBodySize)+" bytes not logged"))
+		}
+		var v interface{}
+		if err := json.Unmarshal(b, &v); err != nil {
+			return append(attrs, slog.String(key, "invalid json body not logged"))
+		}
+		for _, field := range o.RedactFields {
+			v = redactField(v, strings.Split(field, "."))
+		}
+		b, _ = json.Marshal(v)
+	}
+
+	s := string(b)
+	if truncated {
+		s += "..."
+	}
+	return append(attrs, slog.String(key, s))
+}
+
+//redactField replaces the value at path in v with REDACTED.
+func redactField(v interface{}, path []string) interface{} {
+	if len(path) == 0 {
+		return Redacted
+	}
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, child := range t {
+			if path[0] == "*" || k == path[0] {
+				t[k] = redactField(child, path[1:])
+			}
+		}
+	case []interface{}:
+		for i, child := range t {
+			if path[0] == "*" || strconv.Itoa(i) == path[0] {
+				t[i] = redactField(child, path[1:])
+			}
+		}
+	}
+	return v
+}
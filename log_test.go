@@ -0,0 +1,128 @@
+package grestclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoggingMiddleware(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Set-Cookie", "session=hunter2")
+		w.Write([]byte(`{"name":"thing","token":"hunter2","items":[{"secret":"hunter2"},{"secret":"hunter2"}]}`))
+	}))
+	defer server.Close()
+
+	var out bytes.Buffer
+	base, _ := url.Parse(server.URL)
+	client, _ := New(base)
+	SetupForJson(client)
+	client.Use(LoggingMiddleware(slog.NewJSONHandler(&out, nil), LogOptions{
+		Headers:       []string{"Content-Type", "Set-Cookie", "X-Api-Key"},
+		RedactHeaders: []string{"Set-Cookie", "X-Api-Key"},
+		RedactFields:  []string{"token", "password", "items.*.secret"},
+		MaxBodySize:   1024,
+	}))
+	client.Headers().Set("X-Api-Key", "hunter2")
+
+	thing := &genericThing{}
+	_, err := client.Post(&Params{
+		Path:         "things",
+		Query:        url.Values{"api_key": {"hunter2"}, "page": {"2"}},
+		Body:         map[string]string{"user": "me", "password": "hunter2"},
+		UnmarshalMap: UnmarshalMap{200: thing},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if thing.Name != "thing" {
+		t.Fatal("Logging the body should not use it up: ", thing)
+	}
+	if strings.Contains(out.String(), "hunter2") {
+		t.Fatal("Secrets were logged: ", out.String())
+	}
+
+	var record map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &record); err != nil {
+		t.Fatal(err)
+	}
+	if record["method"] != "POST" || record["status"] != float64(200) || record["attempts"] != float64(1) {
+		t.Fatal("Wrong record: ", out.String())
+	}
+	if !strings.Contains(record["url"].(string), "api_key=REDACTED") || !strings.Contains(record["url"].(string), "page=2") {
+		t.Fatal("Query was not redacted: ", record["url"])
+	}
+	if record["request_body"] != `{"password":"REDACTED","user":"me"}` {
+		t.Fatal("Wrong request body: ", record["request_body"])
+	}
+	if record["response_body"] != `{"items":[{"secret":"REDACTED"},{"secret":"REDACTED"}],"name":"thing","token":"REDACTED"}` {
+		t.Fatal("Wrong response body: ", record["response_body"])
+	}
+	headers := record["request_headers"].(map[string]interface{})
+	if headers["X-Api-Key"] != Redacted || headers["Content-Type"] != "application/json" {
+		t.Fatal("Wrong request headers: ", headers)
+	}
+	if record["response_headers"].(map[string]interface{})["Set-Cookie"] != Redacted {
+		t.Fatal("Wrong response headers: ", record["response_headers"])
+	}
+}
+
+func TestLoggingMiddlewareCountsAttemptsAndErrors(t *testing.T) {
+	tries := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		tries++
+		if tries < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write(bytes.Repeat([]byte("a"), 20))
+	}))
+	defer server.Close()
+
+	var out bytes.Buffer
+	base, _ := url.Parse(server.URL)
+	client, _ := New(base)
+	client.SetRetryPolicy(&RetryPolicy{MaxAttempts: 3, MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond})
+	client.Use(LoggingMiddleware(slog.NewTextHandler(&out, nil), LogOptions{MaxBodySize: 5}))
+
+	res, err := client.Get(&Params{KeepBodyOpen: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if !strings.Contains(out.String(), "attempts=3") || strings.Contains(out.String(), "response_body") {
+		t.Fatal("Wrong record, kept bodies should not be logged: ", out.String())
+	}
+	if len(body) != 20 {
+		t.Fatal("Body should be untouched: ", string(body))
+	}
+
+	out.Reset()
+	thing := ""
+	client.SetRetryPolicy(nil)
+	if _, err = client.Get(&Params{UnmarshalMap: UnmarshalMap{200: &thing}}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "response_body=aaaaa...") || thing != strings.Repeat("a", 20) {
+		t.Fatal("Logged body should be cut off but the whole body unmarshaled: ", out.String(), thing)
+	}
+
+	out.Reset()
+	bad, _ := url.Parse("http://localhost:1")
+	client.SetBaseUrl(bad)
+	if _, err = client.Get(&Params{}); err == nil {
+		t.Fatal("Request should fail.")
+	}
+	if !strings.Contains(out.String(), "level=ERROR") || !strings.Contains(out.String(), "error=") {
+		t.Fatal("Failure was not logged as an error: ", out.String())
+	}
+}
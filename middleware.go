@@ -0,0 +1,146 @@
+package grestclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+//Handler performs a request built by the client. p holds the Params the
+//request was made with. The response body is closed by the client once
+//it is unmarshaled unless p.KeepBodyOpen is set.
+type Handler func(r *http.Request, p *Params) (*http.Response, error)
+
+//Middleware wraps the Handler performing a request. It can change the
+//request before calling next, look at or replace the response after, time
+//the call or skip next altogether and answer with a response of its own.
+//
+//	func Timing(next Handler) Handler {
+//		return func(r *http.Request, p *Params) (*http.Response, error) {
+//			start := time.Now()
+//			res, err := next(r, p)
+//			log.Println(r.Method, r.URL, time.Since(start))
+//			return res, err
+//		}
+//	}
+//
+//The RequestMutators run before all Middleware and the ResponseMutators
+//after. The innermost Handler authenticates the request and sends it with
+//the HttpDoer, going through the RetryPolicy, CircuitBreaker and
+//RateLimiter, so Middleware sees each request once however many attempts
+//are made.
+type Middleware func(next Handler) Handler
+
+//Use adds Middleware to the client. The first one added is the outermost,
+//seeing the request first and the response last.
+func (c *Client) Use(m ...Middleware) *Client {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.middleware = append(c.middleware[:len(c.middleware):len(c.middleware)], m...)
+	return c
+}
+
+//SetMiddleware replaces the Middleware of the client.
+func (c *Client) SetMiddleware(m ...Middleware) *Client {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.middleware = m
+	return c
+}
+
+//Middleware returns the Middleware added with Use.
+func (c *Client) Middleware() []Middleware {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.middleware
+}
+
+//RequestMutatorMiddleware turns RequestMutators into Middleware calling
+//them in order before next. The request is not made if one of them fails
+//or the request's context is done.
+func RequestMutatorMiddleware(rm ...RequestMutator) Middleware {
+	return func(next Handler) Handler {
+		return func(r *http.Request, p *Params) (*http.Response, error) {
+			for _, m := range rm {
+				if err := canceled(r.Context(), nil); err != nil {
+					return nil, err
+				}
+				if err := m(r); err != nil {
+					return nil, err
+				}
+			}
+			return next(r, p)
+		}
+	}
+}
+
+//ResponseMutatorMiddleware turns ResponseMutators into Middleware calling
+//them in order after next. The response is returned with the error of the
+//first one that fails.
+func ResponseMutatorMiddleware(rm ...ResponseMutator) Middleware {
+	return func(next Handler) Handler {
+		return func(r *http.Request, p *Params) (*http.Response, error) {
+			response, err := next(r, p)
+			if err != nil {
+				return response, err
+			}
+			for _, m := range rm {
+				if err = m(response); err != nil {
+					return response, err
+				}
+			}
+			return response, nil
+		}
+	}
+}
+
+//handler returns the client's Handler with the mutators and Middleware
+//wrapped around the request being sent.
+func (c *Client) handler() Handler {
+	h := c.perform
+	for i := len(c.middleware) - 1; i >= 0; i-- {
+		h = c.middleware[i](h)
+	}
+	h = ResponseMutatorMiddleware(c.resMutators...)(h)
+	return RequestMutatorMiddleware(c.reqMutators...)(h)
+}
+
+type requestInfoKey struct{}
+
+//requestInfo tells Middleware about what the client does with a request
+//after they run.
+type requestInfo struct {
+	//authenticated is true when an Authenticator adds credentials
+	authenticated bool
+	//maxBodySize is the limit set with SetMaxBodySize
+	maxBodySize int64
+}
+
+//withRequestInfo returns a copy of r telling Middleware about c.
+func (c *Client) withRequestInfo(r *http.Request) *http.Request {
+	info := requestInfo{authenticated: c.auth != nil, maxBodySize: c.maxBodySize}
+	return r.WithContext(context.WithValue(r.Context(), requestInfoKey{}, info))
+}
+
+//requestInfoOf returns what r was told by withRequestInfo.
+func requestInfoOf(r *http.Request) requestInfo {
+	info, _ := r.Context().Value(requestInfoKey{}).(requestInfo)
+	return info
+}
+
+//perform is the innermost Handler. It authenticates r and sends it.
+func (c *Client) perform(r *http.Request, p *Params) (*http.Response, error) {
+	if err := canceled(r.Context(), nil); err != nil {
+		return nil, err
+	}
+	if err := c.authenticate(r); err != nil {
+		return nil, err
+	}
+	response, err := c.roundTrip(r)
+	if err != nil {
+		return nil, err
+	}
+	return c.retryUnauthorized(r, response)
+}
+
+var errNoResponse = errors.New("grestclient: middleware returned neither a response nor an error")
@@ -0,0 +1,101 @@
+package grestclient
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestMiddlewareOrder(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("X-Order", req.Header.Get("X-Order"))
+	}))
+	defer server.Close()
+
+	base, _ := url.Parse(server.URL)
+	client, _ := New(base)
+
+	var order []string
+	mark := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return func(r *http.Request, p *Params) (*http.Response, error) {
+				order = append(order, name+" in")
+				r.Header.Add("X-Order", name)
+				res, err := next(r, p)
+				order = append(order, name+" out")
+				return res, err
+			}
+		}
+	}
+	client.AddRequestMutators(func(r *http.Request) error {
+		order = append(order, "request mutator")
+		r.Header.Add("X-Order", "mutator")
+		return nil
+	})
+	client.AddResponseMutators(func(res *http.Response) error {
+		order = append(order, "response mutator")
+		return nil
+	})
+	client.Use(mark("first"), mark("second"))
+
+	res, err := client.Get(&Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "request mutator,first in,second in,second out,first out,response mutator"
+	if strings.Join(order, ",") != expected {
+		t.Fatal("Wrong order: ", order)
+	}
+	if res.Header.Get("X-Order") != "mutator" {
+		t.Fatal("Server should see the headers from the mutator first: ", res.Header.Get("X-Order"))
+	}
+}
+
+func TestMiddlewareShortCircuits(t *testing.T) {
+	base, _ := url.Parse("http://localhost:1")
+	client, _ := New(base)
+	SetupForJson(client)
+
+	client.Use(func(next Handler) Handler {
+		return func(r *http.Request, p *Params) (*http.Response, error) {
+			return &http.Response{
+				StatusCode:    http.StatusOK,
+				Header:        http.Header{"Content-Type": []string{"application/json"}},
+				Body:          ioutil.NopCloser(strings.NewReader(`{"name":"cached"}`)),
+				ContentLength: -1,
+				Request:       r,
+			}, nil
+		}
+	})
+
+	thing := &genericThing{}
+	if _, err := client.Get(&Params{UnmarshalMap: UnmarshalMap{200: thing}}); err != nil {
+		t.Fatal(err)
+	}
+	if thing.Name != "cached" {
+		t.Fatal("Response from the middleware was not unmarshaled: ", thing)
+	}
+}
+
+func TestMutatorErrorsStopTheRequest(t *testing.T) {
+	called := false
+	base, _ := url.Parse("http://localhost:1")
+	client, _ := New(base)
+	client.Use(func(next Handler) Handler {
+		return func(r *http.Request, p *Params) (*http.Response, error) {
+			called = true
+			return next(r, p)
+		}
+	})
+
+	fail := errors.New("nope")
+	client.AddRequestMutators(func(r *http.Request) error { return fail })
+	if _, err := client.Get(&Params{}); err != fail || called {
+		t.Fatal("A failing RequestMutator should stop the request: ", err, called)
+	}
+}
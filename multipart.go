@@ -0,0 +1,158 @@
+package grestclient
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/textproto"
+	"net/url"
+	"strings"
+)
+
+//MultipartForm is the body used with MultipartMarshalerFunc and the
+//destination used with MultipartUnmarshalerFunc.
+type MultipartForm struct {
+	Fields url.Values
+	Files  []MultipartFile
+}
+
+//MultipartFile is a file part of a MultipartForm.
+type MultipartFile struct {
+	//FieldName is the form field the file is sent as.
+	FieldName string
+	FileName  string
+	//ContentType of the part. Defaults to application/octet-stream.
+	ContentType string
+	Content     []byte
+}
+
+//ContentTyper can be implemented by the ReadLener a MarshalerFunc returns
+//when the body needs a Content-Type the marshaler works out itself, like
+//the boundary of a multipart body. The client sets the request's
+//Content-Type to it.
+type ContentTyper interface {
+	ContentType() string
+}
+
+//multipartBody is a ReadLener that knows its multipart Content-Type.
+type multipartBody struct {
+	*bytes.Buffer
+	contentType string
+}
+
+func (b *multipartBody) ContentType() string {
+	return b.contentType
+}
+
+//MultipartMarshalerFunc marshals a MultipartForm, *MultipartForm or
+//url.Values into a multipart/form-data body. The ReadLener returned is a
+//ContentTyper so the request gets a Content-Type with the right boundary.
+func MultipartMarshalerFunc(v interface{}) (ReadLener, error) {
+	var form *MultipartForm
+	switch t := v.(type) {
+	case MultipartForm:
+		form = &t
+	case *MultipartForm:
+		form = t
+	case url.Values:
+		form = &MultipartForm{Fields: t}
+	default:
+		return nil, fmt.Errorf("Did not know how to use %T as a multipart form.", v)
+	}
+
+	buf := &bytes.Buffer{}
+	w := multipart.NewWriter(buf)
+	for name, values := range form.Fields {
+		for _, value := range values {
+			if err := w.WriteField(name, value); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, file := range form.Files {
+		h := make(textproto.MIMEHeader)
+		h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`,
+			escapeQuotes(file.FieldName), escapeQuotes(file.FileName)))
+		contentType := file.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		h.Set("Content-Type", contentType)
+
+		part, err := w.CreatePart(h)
+		if err != nil {
+			return nil, err
+		}
+		if _, err = part.Write(file.Content); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return &multipartBody{Buffer: buf, contentType: w.FormDataContentType()}, nil
+}
+
+//MultipartUnmarshalerFunc unmarshals a multipart body into a
+//*MultipartForm. Parts with a file name go into Files and the rest
+//into Fields. The boundary is taken from the first line of the body.
+func MultipartUnmarshalerFunc(b []byte, v interface{}) error {
+	form, ok := v.(*MultipartForm)
+	if !ok {
+		return errors.New("You must pass a *MultipartForm to unmarshal a multipart body into.")
+	}
+
+	line, err := bufio.NewReader(bytes.NewReader(b)).ReadString('\n')
+	if err != nil || !strings.HasPrefix(line, "--") {
+		return errors.New("Could not find the multipart boundary in the body.")
+	}
+	boundary := strings.TrimSpace(strings.TrimPrefix(line, "--"))
+
+	if form.Fields == nil {
+		form.Fields = make(url.Values)
+	}
+	r := multipart.NewReader(bytes.NewReader(b), boundary)
+	for {
+		part, err := r.NextPart()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		content, err := ioutil.ReadAll(part)
+		if err != nil {
+			return err
+		}
+		if part.FileName() == "" {
+			form.Fields.Add(part.FormName(), string(content))
+			continue
+		}
+		form.Files = append(form.Files, MultipartFile{
+			FieldName:   part.FormName(),
+			FileName:    part.FileName(),
+			ContentType: part.Header.Get("Content-Type"),
+			Content:     content,
+		})
+	}
+}
+
+//SetupForMultipart is a convenience method that sets the
+//marshaler and unmarshaler funcs on the client to be the
+//Multipart funcs in this package. No mutator is needed since
+//the Content-Type comes from the marshaled body.
+func SetupForMultipart(c *Client) {
+	c.SetMarshaler(MultipartMarshalerFunc)
+	c.SetUnmarshaler(MultipartUnmarshalerFunc)
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+func escapeQuotes(s string) string {
+	return quoteEscaper.Replace(s)
+}
@@ -0,0 +1,79 @@
+package grestclient
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestMultipartUpload(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if err := req.ParseMultipartForm(1 << 20); err != nil {
+			t.Fatal(err)
+		}
+		if req.FormValue("title") != "report" {
+			t.Fatal("Field was not sent: ", req.FormValue("title"))
+		}
+		file, header, err := req.FormFile("upload")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+		if header.Filename != "report.csv" || header.Header.Get("Content-Type") != "text/csv" {
+			t.Fatal("Unexpected file part: ", header.Filename, header.Header)
+		}
+		b, _ := ioutil.ReadAll(file)
+		if string(b) != "a,b\n1,2\n" {
+			t.Fatal("Unexpected file content: ", string(b))
+		}
+	}))
+	defer server.Close()
+
+	base, err := url.Parse(server.URL)
+	client, err := New(base)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetupForMultipart(client)
+
+	_, err = client.Post(&Params{
+		Path: "upload",
+		Body: &MultipartForm{
+			Fields: url.Values{"title": []string{"report"}},
+			Files: []MultipartFile{{
+				FieldName:   "upload",
+				FileName:    "report.csv",
+				ContentType: "text/csv",
+				Content:     []byte("a,b\n1,2\n"),
+			}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMultipartRoundTrip(t *testing.T) {
+	r, err := MultipartMarshalerFunc(MultipartForm{
+		Fields: url.Values{"a": []string{"1"}},
+		Files:  []MultipartFile{{FieldName: "f", FileName: "f.bin", Content: []byte{1, 2}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadAll(r)
+
+	var form MultipartForm
+	if err = MultipartUnmarshalerFunc(b, &form); err != nil {
+		t.Fatal(err)
+	}
+	if form.Fields.Get("a") != "1" || len(form.Files) != 1 {
+		t.Fatal("Unexpected form: ", form)
+	}
+	if form.Files[0].ContentType != "application/octet-stream" || len(form.Files[0].Content) != 2 {
+		t.Fatal("Unexpected file: ", form.Files[0])
+	}
+}
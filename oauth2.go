@@ -0,0 +1,270 @@
+package grestclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+//OAuth2 grant types supported by OAuth2Config.
+const (
+	ClientCredentialsGrant = "client_credentials"
+	RefreshTokenGrant      = "refresh_token"
+	PasswordGrant          = "password"
+)
+
+//OAuth2Token is a token returned by an OAuth2 token endpoint.
+type OAuth2Token struct {
+	AccessToken  string `json:"access_token" form:"access_token"`
+	TokenType    string `json:"token_type" form:"token_type"`
+	RefreshToken string `json:"refresh_token" form:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in" form:"expires_in"`
+	Scope        string `json:"scope" form:"scope"`
+
+	//Expiry is worked out from ExpiresIn when the token is received.
+	//It is zero if the token doesn't expire.
+	Expiry time.Time `json:"-" form:"-"`
+}
+
+//valid reports whether t can still be used delta before it expires.
+func (t *OAuth2Token) valid(delta time.Duration, now time.Time) bool {
+	if t == nil || t.AccessToken == "" {
+		return false
+	}
+	return t.Expiry.IsZero() || now.Add(delta).Before(t.Expiry)
+}
+
+//OAuth2Error is the error body an OAuth2 token endpoint returns.
+type OAuth2Error struct {
+	StatusCode  int    `json:"-" form:"-"`
+	Code        string `json:"error" form:"error"`
+	Description string `json:"error_description" form:"error_description"`
+}
+
+func (e *OAuth2Error) Error() string {
+	if e.Description != "" {
+		return fmt.Sprintf("grestclient: oauth2 token request failed with %d: %s: %s", e.StatusCode, e.Code, e.Description)
+	}
+	return fmt.Sprintf("grestclient: oauth2 token request failed with %d: %s", e.StatusCode, e.Code)
+}
+
+//OAuth2Config describes how to get tokens from a token endpoint.
+type OAuth2Config struct {
+	TokenURL     *url.URL
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+
+	//Grant is ClientCredentialsGrant, RefreshTokenGrant or PasswordGrant.
+	//Once a token comes with a refresh token, it is used to get the
+	//next one whatever the Grant is. If the token endpoint turns the
+	//refresh token down, because it expired or was revoked, it is dropped
+	//and the Grant is used again, unless it is RefreshTokenGrant.
+	Grant string
+
+	//Username and Password are used by the PasswordGrant.
+	Username string
+	Password string
+
+	//RefreshToken is the starting refresh token for the RefreshTokenGrant.
+	RefreshToken string
+
+	//ClientAuthInBody sends the client id and secret as form fields
+	//instead of with basic auth.
+	ClientAuthInBody bool
+
+	//ExpiryDelta is how long before a token expires it gets replaced.
+	//Defaults to 30 seconds.
+	ExpiryDelta time.Duration
+
+	//HttpClient is used for the token requests. Defaults to http.DefaultClient.
+	HttpClient *http.Client
+}
+
+//OAuth2 is an Authenticator that gets, caches and refreshes OAuth2
+//tokens. Token requests are made with a grestclient Client sending url
+//encoded forms and accepting json or form responses.
+//It is safe for concurrent use: while a token is being fetched other
+//requests wait for it instead of fetching their own.
+//
+//When a request authenticated by it gets a 401 the token is refreshed
+//and the request is sent once more.
+type OAuth2 struct {
+	config OAuth2Config
+	client *Client
+
+	mu    sync.Mutex
+	token *OAuth2Token
+	now   func() time.Time
+}
+
+//NewOAuth2 returns an OAuth2 Authenticator for config.
+func NewOAuth2(config OAuth2Config) (*OAuth2, error) {
+	if config.TokenURL == nil {
+		return nil, errors.New("Please specify a non nil token url.")
+	}
+	switch config.Grant {
+	case ClientCredentialsGrant, RefreshTokenGrant, PasswordGrant:
+	default:
+		return nil, fmt.Errorf("Unsupported oauth2 grant %q.", config.Grant)
+	}
+	if config.ExpiryDelta == 0 {
+		config.ExpiryDelta = 30 * time.Second
+	}
+
+	c, err := New(cloneUrl(config.TokenURL))
+	if err != nil {
+		return nil, err
+	}
+	SetupForForm(c)
+	c.SetCodecs(NewCodecRegistry().
+		Register("application/json", Codec{Unmarshaler: JsonUnmarshalerFunc}).
+		Register(FormContentType, Codec{Unmarshaler: FormUnmarshalerFunc}))
+	c.Headers().Set("Accept", "application/json")
+	if config.HttpClient != nil {
+		c.SetHttpDoer(config.HttpClient)
+	}
+
+	o := &OAuth2{config: config, client: c, now: time.Now}
+	if config.RefreshToken != "" {
+		o.token = &OAuth2Token{RefreshToken: config.RefreshToken}
+	}
+	return o, nil
+}
+
+//Token returns a valid token, fetching a new one if the cached one is
+//missing or about to expire.
+func (o *OAuth2) Token(ctx context.Context) (*OAuth2Token, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.token.valid(o.config.ExpiryDelta, o.now()) {
+		return o.token, nil
+	}
+	return o.fetch(ctx)
+}
+
+//Refresh fetches a new token even if the cached one is still valid.
+func (o *OAuth2) Refresh(ctx context.Context) (*OAuth2Token, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.fetch(ctx)
+}
+
+//Authenticate sets the Authorization header of r to the current token.
+func (o *OAuth2) Authenticate(r *http.Request) error {
+	token, err := o.Token(r.Context())
+	if err != nil {
+		return err
+	}
+	setToken(r, token)
+	return nil
+}
+
+//Reauthenticate is called when r was answered with a 401. It refreshes
+//the token, unless another request already did since r was sent, and
+//sets the new token on r.
+func (o *OAuth2) Reauthenticate(r *http.Request) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	token := o.token
+	if token == nil || authorization(token) == r.Header.Get("Authorization") {
+		var err error
+		if token, err = o.fetch(r.Context()); err != nil {
+			return err
+		}
+	}
+	setToken(r, token)
+	return nil
+}
+
+func authorization(t *OAuth2Token) string {
+	tokenType := t.TokenType
+	if tokenType == "" || strings.EqualFold(tokenType, "bearer") {
+		tokenType = "Bearer"
+	}
+	return tokenType + " " + t.AccessToken
+}
+
+func setToken(r *http.Request, t *OAuth2Token) {
+	r.Header.Set("Authorization", authorization(t))
+}
+
+//fetch gets a new token. o.mu must be held.
+func (o *OAuth2) fetch(ctx context.Context) (*OAuth2Token, error) {
+	if o.token != nil && o.token.RefreshToken != "" {
+		form := url.Values{}
+		form.Set("grant_type", RefreshTokenGrant)
+		form.Set("refresh_token", o.token.RefreshToken)
+		token, err := o.request(ctx, form)
+		var oauthErr *OAuth2Error
+		turnedDown := errors.As(err, &oauthErr) && oauthErr.StatusCode >= 400 && oauthErr.StatusCode < 500
+		if !turnedDown || o.config.Grant == RefreshTokenGrant {
+			return token, err
+		}
+		//the refresh token was turned down, start over with the grant
+		o.token = nil
+	}
+
+	form := url.Values{}
+	switch {
+	case o.config.Grant == PasswordGrant:
+		form.Set("grant_type", PasswordGrant)
+		form.Set("username", o.config.Username)
+		form.Set("password", o.config.Password)
+	case o.config.Grant == ClientCredentialsGrant:
+		form.Set("grant_type", ClientCredentialsGrant)
+	default:
+		return nil, errors.New("There is no refresh token to get an oauth2 token with.")
+	}
+	return o.request(ctx, form)
+}
+
+//request sends form to the token endpoint and keeps the token it returns.
+func (o *OAuth2) request(ctx context.Context, form url.Values) (*OAuth2Token, error) {
+	if len(o.config.Scopes) > 0 {
+		form.Set("scope", strings.Join(o.config.Scopes, " "))
+	}
+
+	c := o.client
+	if o.config.ClientAuthInBody {
+		form.Set("client_id", o.config.ClientID)
+		if o.config.ClientSecret != "" {
+			form.Set("client_secret", o.config.ClientSecret)
+		}
+	} else if o.config.ClientID != "" {
+		c = c.Clone()
+		c.SetAuthenticator(BasicAuth{
+			Username: url.QueryEscape(o.config.ClientID),
+			Password: url.QueryEscape(o.config.ClientSecret),
+		})
+	}
+
+	result, err := DoResult[OAuth2Token, OAuth2Error](c, "POST", &Params{Body: form, Context: ctx})
+	if err != nil {
+		return nil, err
+	}
+	if result.Failed() || result.Success.AccessToken == "" {
+		result.Error.StatusCode = result.Response.StatusCode
+		if result.Error.Code == "" {
+			result.Error.Code = "invalid_response"
+		}
+		return nil, &result.Error
+	}
+
+	token := result.Success
+	if token.ExpiresIn > 0 {
+		token.Expiry = o.now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	}
+	if token.RefreshToken == "" && o.token != nil {
+		//servers may leave out the refresh token when it doesn't change
+		token.RefreshToken = o.token.RefreshToken
+	}
+	o.token = &token
+	return o.token, nil
+}
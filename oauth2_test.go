@@ -0,0 +1,251 @@
+package grestclient
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTokenServer(t *testing.T, handle func(form url.Values, w http.ResponseWriter)) (*httptest.Server, *url.URL) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Content-Type") != FormContentType {
+			t.Error("Token request was not a form: ", req.Header.Get("Content-Type"))
+		}
+		if err := req.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		if u, p, ok := req.BasicAuth(); !ok || u != "id" || p != "secret" {
+			t.Error("Client credentials were not sent with basic auth.")
+		}
+		handle(req.PostForm, w)
+	}))
+	tokenURL, _ := url.Parse(server.URL + "/token")
+	return server, tokenURL
+}
+
+func TestOAuth2ClientCredentials(t *testing.T) {
+	var fetches int32
+	tokens, tokenURL := newTokenServer(t, func(form url.Values, w http.ResponseWriter) {
+		if form.Get("grant_type") != ClientCredentialsGrant || form.Get("scope") != "read write" {
+			t.Error("Wrong token request: ", form.Encode())
+		}
+		n := atomic.AddInt32(&fetches, 1)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token":"token%d","token_type":"bearer","expires_in":3600}`, n)
+	})
+	defer tokens.Close()
+
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") != "Bearer token1" {
+			t.Error("Wrong token: ", req.Header.Get("Authorization"))
+		}
+	}))
+	defer api.Close()
+
+	auth, err := NewOAuth2(OAuth2Config{
+		TokenURL:     tokenURL,
+		ClientID:     "id",
+		ClientSecret: "secret",
+		Scopes:       []string{"read", "write"},
+		Grant:        ClientCredentialsGrant,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	base, _ := url.Parse(api.URL)
+	client, _ := New(base)
+	client.SetAuthenticator(auth)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r, _ := http.NewRequest("GET", api.URL, nil)
+			auth.Authenticate(r)
+		}()
+	}
+	wg.Wait()
+	client.Get(&Params{Path: "things"})
+
+	if fetches != 1 {
+		t.Fatal("Token should have been fetched once and cached, was fetched: ", fetches)
+	}
+}
+
+func TestOAuth2RefreshesBeforeExpiry(t *testing.T) {
+	var grants []string
+	tokens, tokenURL := newTokenServer(t, func(form url.Values, w http.ResponseWriter) {
+		grants = append(grants, form.Get("grant_type"))
+		if form.Get("grant_type") == RefreshTokenGrant && form.Get("refresh_token") != "refresh" {
+			t.Error("Wrong refresh token: ", form.Get("refresh_token"))
+		}
+		if form.Get("grant_type") == PasswordGrant && (form.Get("username") != "me" || form.Get("password") != "pass") {
+			t.Error("Wrong user credentials: ", form.Encode())
+		}
+		w.Header().Set("Content-Type", FormContentType)
+		fmt.Fprintf(w, "access_token=token%d&refresh_token=refresh&expires_in=60", len(grants))
+	})
+	defer tokens.Close()
+
+	auth, err := NewOAuth2(OAuth2Config{
+		TokenURL:     tokenURL,
+		ClientID:     "id",
+		ClientSecret: "secret",
+		Grant:        PasswordGrant,
+		Username:     "me",
+		Password:     "pass",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	auth.now = func() time.Time { return now }
+
+	token, err := auth.Token(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken != "token1" || !token.Expiry.Equal(now.Add(time.Minute)) {
+		t.Fatal("Wrong token: ", token)
+	}
+
+	now = now.Add(20 * time.Second)
+	if token, _ = auth.Token(nil); token.AccessToken != "token1" {
+		t.Fatal("Token should still be cached: ", token.AccessToken)
+	}
+
+	//within the 30 second expiry delta
+	now = now.Add(20 * time.Second)
+	if token, _ = auth.Token(nil); token.AccessToken != "token2" {
+		t.Fatal("Token should have been refreshed: ", token.AccessToken)
+	}
+	if strings.Join(grants, ",") != "password,refresh_token" {
+		t.Fatal("Wrong grants used: ", grants)
+	}
+}
+
+func TestOAuth2RetriesUnauthorizedOnce(t *testing.T) {
+	var fetches int32
+	tokens, tokenURL := newTokenServer(t, func(form url.Values, w http.ResponseWriter) {
+		n := atomic.AddInt32(&fetches, 1)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token":"token%d"}`, n)
+	})
+	defer tokens.Close()
+
+	var calls int32
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		body := make([]byte, 4)
+		n, _ := req.Body.Read(body)
+		if string(body[:n]) != "data" {
+			t.Error("Body was not sent again: ", string(body[:n]))
+		}
+		if req.Header.Get("Authorization") != "Bearer token2" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer api.Close()
+
+	auth, _ := NewOAuth2(OAuth2Config{
+		TokenURL:     tokenURL,
+		ClientID:     "id",
+		ClientSecret: "secret",
+		Grant:        ClientCredentialsGrant,
+	})
+	base, _ := url.Parse(api.URL)
+	client, _ := New(base)
+	client.SetAuthenticator(auth)
+
+	res, err := client.Post(&Params{Path: "things", Body: "data"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusOK || calls != 2 || fetches != 2 {
+		t.Fatal("Request was not retried with a new token: ", res.StatusCode, calls, fetches)
+	}
+
+	//the new token is rejected too so the 401 comes back after one retry
+	auth.Refresh(nil)
+	res, err = client.Post(&Params{Path: "things", Body: "data"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusUnauthorized || calls != 4 {
+		t.Fatal("Request should have been retried once: ", res.StatusCode, calls)
+	}
+}
+
+func TestOAuth2TokenError(t *testing.T) {
+	tokens, tokenURL := newTokenServer(t, func(form url.Values, w http.ResponseWriter) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"error":"invalid_client","error_description":"bad secret"}`)
+	})
+	defer tokens.Close()
+
+	auth, _ := NewOAuth2(OAuth2Config{
+		TokenURL:     tokenURL,
+		ClientID:     "id",
+		ClientSecret: "secret",
+		Grant:        ClientCredentialsGrant,
+	})
+
+	_, err := auth.Token(nil)
+	oauthErr, ok := err.(*OAuth2Error)
+	if !ok || oauthErr.StatusCode != http.StatusBadRequest || oauthErr.Code != "invalid_client" || oauthErr.Description != "bad secret" {
+		t.Fatal("Wrong error: ", err)
+	}
+}
+
+func TestOAuth2TurnedDownRefreshToken(t *testing.T) {
+	var grants []string
+	tokens, tokenURL := newTokenServer(t, func(form url.Values, w http.ResponseWriter) {
+		grants = append(grants, form.Get("grant_type"))
+		w.Header().Set("Content-Type", "application/json")
+		if form.Get("grant_type") == RefreshTokenGrant {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error":"invalid_grant"}`)
+			return
+		}
+		fmt.Fprintf(w, `{"access_token":"token%d","refresh_token":"revoked"}`, len(grants))
+	})
+	defer tokens.Close()
+
+	auth, _ := NewOAuth2(OAuth2Config{
+		TokenURL:     tokenURL,
+		ClientID:     "id",
+		ClientSecret: "secret",
+		Grant:        PasswordGrant,
+	})
+	auth.Token(nil)
+	token, err := auth.Refresh(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken != "token3" || strings.Join(grants, ",") != "password,refresh_token,password" {
+		t.Fatal("The grant should have been used again: ", token.AccessToken, grants)
+	}
+
+	//with nothing else to fall back on the error is returned
+	grants = nil
+	auth, _ = NewOAuth2(OAuth2Config{
+		TokenURL:     tokenURL,
+		ClientID:     "id",
+		ClientSecret: "secret",
+		Grant:        RefreshTokenGrant,
+		RefreshToken: "revoked",
+	})
+	_, err = auth.Token(nil)
+	if oauthErr, ok := err.(*OAuth2Error); !ok || oauthErr.Code != "invalid_grant" || len(grants) != 1 {
+		t.Fatal("Wrong error: ", err, grants)
+	}
+}
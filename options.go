@@ -0,0 +1,240 @@
+package grestclient
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+//Option configures a Client made with New or derived with With.
+//Options are applied in the order they are given.
+type Option func(c *Client) error
+
+//With returns a new client with the settings of c, as with Clone, and
+//opts applied on top. c is left as it is.
+//
+//	admin, err := c.With(
+//		WithHeaders(http.Header{"X-Role": {"admin"}}),
+//		WithTimeout(time.Minute),
+//	)
+func (c *Client) With(opts ...Option) (*Client, error) {
+	cc := c.Clone()
+	if err := cc.apply(opts); err != nil {
+		return nil, err
+	}
+	return cc, nil
+}
+
+func (c *Client) apply(opts []Option) error {
+	for _, opt := range opts {
+		if opt == nil {
+			continue
+		}
+		if err := opt(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//WithBaseUrl sets the base url, see SetBaseUrl.
+func WithBaseUrl(u *url.URL) Option {
+	return func(c *Client) error {
+		if u == nil {
+			return c.SetBaseUrl(nil)
+		}
+		return c.SetBaseUrl(cloneUrl(u))
+	}
+}
+
+//WithHeaders adds h to the default headers. Headers already set with
+//the same names are replaced.
+func WithHeaders(h http.Header) Option {
+	return func(c *Client) error {
+		c.UpdateHeaders(func(headers http.Header) {
+			for name, values := range h {
+				headers[http.CanonicalHeaderKey(name)] = append([]string(nil), values...)
+			}
+		})
+		return nil
+	}
+}
+
+//WithQuery adds q to the default query. Values already set with the
+//same names are replaced.
+func WithQuery(q url.Values) Option {
+	return func(c *Client) error {
+		c.UpdateQuery(func(query url.Values) {
+			for name, values := range q {
+				query[name] = append([]string(nil), values...)
+			}
+		})
+		return nil
+	}
+}
+
+//WithJson sets the client up for json, see SetupForJson.
+func WithJson() Option {
+	return func(c *Client) error {
+		SetupForJson(c)
+		return nil
+	}
+}
+
+//WithMarshaler sets the marshaler, see SetMarshaler.
+func WithMarshaler(f MarshalerFunc) Option {
+	return func(c *Client) error {
+		c.SetMarshaler(f)
+		return nil
+	}
+}
+
+//WithUnmarshaler sets the unmarshaler, see SetUnmarshaler.
+func WithUnmarshaler(f UnmarshalerFunc) Option {
+	return func(c *Client) error {
+		c.SetUnmarshaler(f)
+		return nil
+	}
+}
+
+//WithCodec registers codec for mediaType in the client's codec registry.
+func WithCodec(mediaType string, codec Codec) Option {
+	return func(c *Client) error {
+		c.Codecs().Register(mediaType, codec)
+		return nil
+	}
+}
+
+//WithCodecs sets the codec registry, see SetCodecs.
+func WithCodecs(r *CodecRegistry) Option {
+	return func(c *Client) error {
+		c.SetCodecs(r)
+		return nil
+	}
+}
+
+//WithHttpDoer sets the http.Client used to send requests, see SetHttpDoer.
+func WithHttpDoer(h *http.Client) Option {
+	return func(c *Client) error {
+		if h == nil {
+			return errors.New("Please specify a non nil http.Client.")
+		}
+		c.SetHttpDoer(h)
+		return nil
+	}
+}
+
+//WithTimeout limits how long a request can take, including the time it
+//takes to read the response body. It sets the Timeout of a copy of the
+//client's http.Client, or of a new one if there is none. The http.Client
+//set with WithHttpDoer or SetHttpDoer, before or after it, is copied and
+//left as it is. A zero d leaves the http.Client's own Timeout. Each
+//attempt of a retried request gets the whole timeout. Use the Context in
+//Params for a limit across attempts.
+func WithTimeout(d time.Duration) Option {
+	return func(c *Client) error {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.timeout = d
+		c.applyTimeout()
+		return nil
+	}
+}
+
+//WithRequestMutators adds RequestMutators, see AddRequestMutators.
+func WithRequestMutators(rm ...RequestMutator) Option {
+	return func(c *Client) error {
+		c.AddRequestMutators(rm...)
+		return nil
+	}
+}
+
+//WithResponseMutators adds ResponseMutators, see AddResponseMutators.
+func WithResponseMutators(rm ...ResponseMutator) Option {
+	return func(c *Client) error {
+		c.AddResponseMutators(rm...)
+		return nil
+	}
+}
+
+//WithMiddleware adds Middleware, see Use.
+func WithMiddleware(m ...Middleware) Option {
+	return func(c *Client) error {
+		c.Use(m...)
+		return nil
+	}
+}
+
+//WithRetry sets the retry policy, see SetRetryPolicy.
+func WithRetry(p *RetryPolicy) Option {
+	return func(c *Client) error {
+		c.SetRetryPolicy(p)
+		return nil
+	}
+}
+
+//WithSuccessRange turns on status errors, see SetSuccessRange.
+func WithSuccessRange(s *SuccessRange) Option {
+	return func(c *Client) error {
+		c.SetSuccessRange(s)
+		return nil
+	}
+}
+
+//WithAuthenticator sets the Authenticator, see SetAuthenticator.
+func WithAuthenticator(a Authenticator) Option {
+	return func(c *Client) error {
+		c.SetAuthenticator(a)
+		return nil
+	}
+}
+
+//WithMaxBodySize limits the size of response bodies, see SetMaxBodySize.
+func WithMaxBodySize(n int64) Option {
+	return func(c *Client) error {
+		c.SetMaxBodySize(n)
+		return nil
+	}
+}
+
+//WithStreamUnmarshaler sets the stream unmarshaler, see
+//SetStreamUnmarshaler.
+func WithStreamUnmarshaler(f StreamUnmarshalerFunc) Option {
+	return func(c *Client) error {
+		c.SetStreamUnmarshaler(f)
+		return nil
+	}
+}
+
+//WithRateLimiter sets the RateLimiter, see SetRateLimiter.
+func WithRateLimiter(l *RateLimiter) Option {
+	return func(c *Client) error {
+		c.SetRateLimiter(l)
+		return nil
+	}
+}
+
+//WithPathRateLimiter sets the RateLimiter for a path pattern, see
+//SetPathRateLimiter.
+func WithPathRateLimiter(pattern string, l *RateLimiter) Option {
+	return func(c *Client) error {
+		return c.SetPathRateLimiter(pattern, l)
+	}
+}
+
+//WithCircuitBreaker sets the CircuitBreaker, see SetCircuitBreaker.
+func WithCircuitBreaker(b *CircuitBreaker) Option {
+	return func(c *Client) error {
+		c.SetCircuitBreaker(b)
+		return nil
+	}
+}
+
+//WithPathCircuitBreaker sets the CircuitBreaker for a path pattern, see
+//SetPathCircuitBreaker.
+func WithPathCircuitBreaker(pattern string, b *CircuitBreaker) Option {
+	return func(c *Client) error {
+		return c.SetPathCircuitBreaker(pattern, b)
+	}
+}
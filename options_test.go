@@ -0,0 +1,149 @@
+package grestclient
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestNewWithOptions(t *testing.T) {
+	var got *http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		got = req
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"name":"thing"}`))
+	}))
+	defer server.Close()
+
+	base, _ := url.Parse(server.URL)
+	var wrapped bool
+	client, err := New(base,
+		WithJson(),
+		WithHeaders(http.Header{"X-Api-Key": {"key"}}),
+		WithQuery(url.Values{"tenant": {"a"}}),
+		WithHttpDoer(&http.Client{}),
+		WithTimeout(time.Minute),
+		WithRetry(&RetryPolicy{MaxAttempts: 2}),
+		WithMiddleware(func(next Handler) Handler {
+			return func(r *http.Request, p *Params) (*http.Response, error) {
+				wrapped = true
+				return next(r, p)
+			}
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	thing := &genericThing{}
+	if _, err = client.Get(&Params{UnmarshalMap: UnmarshalMap{200: thing}}); err != nil {
+		t.Fatal(err)
+	}
+	if thing.Name != "thing" || !wrapped {
+		t.Fatal("Options were not applied: ", thing, wrapped)
+	}
+	if got.Header.Get("X-Api-Key") != "key" || got.Header.Get("Accept") != "application/json" ||
+		got.URL.Query().Get("tenant") != "a" {
+		t.Fatal("Wrong request: ", got.Header, got.URL)
+	}
+	if client.RetryPolicy().MaxAttempts != 2 {
+		t.Fatal("Retry policy was not set.")
+	}
+	if doer := client.GetHttpDoer().(*http.Client); doer.Timeout != time.Minute {
+		t.Fatal("Timeout was not set: ", doer.Timeout)
+	}
+
+	if _, err = New(base, WithHttpDoer(nil)); err == nil {
+		t.Fatal("Expected an error for a nil http.Client.")
+	}
+	if _, err = New(base, WithPathRateLimiter("[", NewRateLimiter(1, 1, 0))); err == nil {
+		t.Fatal("Expected an error for a bad pattern.")
+	}
+}
+
+func TestWithDerivesNewClient(t *testing.T) {
+	base, _ := url.Parse("http://example.com/api")
+	doer := &http.Client{}
+	client, _ := New(base,
+		WithHttpDoer(doer),
+		WithHeaders(http.Header{"X-Role": {"user"}, "X-Keep": {"yes"}}),
+		WithQuery(url.Values{"tenant": {"a"}}),
+	)
+
+	other, _ := url.Parse("http://other.example.com")
+	admin, err := client.With(
+		WithBaseUrl(other),
+		WithHeaders(http.Header{"x-role": {"admin"}}),
+		WithQuery(url.Values{"debug": {"1"}}),
+		WithTimeout(time.Second),
+		WithSuccessRange(DefaultSuccessRange),
+		WithCodec("application/json", Codec{JsonMarshalerFunc, JsonUnmarshalerFunc}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if admin.Headers().Get("X-Role") != "admin" || admin.Headers().Get("X-Keep") != "yes" {
+		t.Fatal("Headers were not derived: ", admin.Headers())
+	}
+	if admin.Query().Get("tenant") != "a" || admin.Query().Get("debug") != "1" {
+		t.Fatal("Query was not derived: ", admin.Query())
+	}
+	if admin.BaseUrl().Host != "other.example.com" || admin.SuccessRange() != DefaultSuccessRange {
+		t.Fatal("Options were not applied.")
+	}
+	if _, ok := admin.Codecs().Unmarshaler("application/json"); !ok {
+		t.Fatal("Codec was not registered.")
+	}
+
+	//the original is untouched
+	if client.Headers().Get("X-Role") != "user" || client.Query().Get("debug") != "" ||
+		client.BaseUrl().Host != "example.com" || client.SuccessRange() != nil {
+		t.Fatal("Original client was changed: ", client.Headers(), client.Query())
+	}
+	if client.GetHttpDoer() != doer || doer.Timeout != 0 || admin.GetHttpDoer() == doer {
+		t.Fatal("Timeout should be set on a copy of the http.Client.")
+	}
+	if _, ok := client.Codecs().Unmarshaler("application/json"); ok {
+		t.Fatal("Codec should only be registered on the derived client.")
+	}
+
+	if _, err = client.With(WithBaseUrl(nil)); err == nil {
+		t.Fatal("Expected an error for a nil url.")
+	}
+}
+
+func TestWithTimeoutBeforeHttpDoer(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	base, _ := url.Parse(server.URL)
+	var sent bool
+	doer := &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		sent = true
+		return http.DefaultTransport.RoundTrip(r)
+	})}
+	client, err := New(base, WithTimeout(50*time.Millisecond), WithHttpDoer(doer))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = client.Get(&Params{}); err == nil || !sent {
+		t.Fatal("Request should have timed out on the given http.Client: ", err, sent)
+	}
+	if doer.Timeout != 0 || client.GetHttpDoer().(*http.Client).Timeout != 50*time.Millisecond {
+		t.Fatal("Timeout should be set on a copy of the http.Client.")
+	}
+
+	//a new http.Client keeps the timeout
+	client.SetHttpDoer(&http.Client{})
+	if client.GetHttpDoer().(*http.Client).Timeout != 50*time.Millisecond {
+		t.Fatal("Timeout was lost.")
+	}
+}
@@ -0,0 +1,321 @@
+package grestclient
+
+import (
+	"errors"
+	"fmt"
+	"iter"
+	"net/http"
+	"net/url"
+	rt "reflect"
+	"strconv"
+	"strings"
+)
+
+//Page describes a page that was just fetched. It is handed to a
+//PageStrategy to work out the request for the next page.
+type Page struct {
+	//Number counts pages from 0.
+	Number int
+	//Params used to request the page.
+	Params   *Params
+	Response *http.Response
+	//Value is a pointer to the unmarshaled page.
+	Value interface{}
+	//Items is the number of items on the page or -1 if the page isn't a
+	//slice, array or map and doesn't have a Len method.
+	Items int
+	//Base is the client's base url.
+	Base *url.URL
+}
+
+//PageStrategy knows how a paginated API links its pages together.
+type PageStrategy interface {
+	//First returns the Params for the first page based on the template
+	//passed to Paginate.
+	First(p *Params) *Params
+	//Next returns the Params for the page after page, or nil if it was
+	//the last one.
+	Next(page *Page) (*Params, error)
+}
+
+//Pagination configures Paginate.
+type Pagination struct {
+	Strategy PageStrategy
+	//Method defaults to GET.
+	Method string
+	//MaxPages stops after this many pages. 0 means no limit.
+	MaxPages int
+	//MaxItems stops after this many items. Pages that are slices are cut
+	//short so no more than MaxItems are yielded in total. 0 means no limit.
+	MaxItems int
+}
+
+//Paginate walks a paginated collection starting with the request in p
+//and yields every page unmarshaled into a T, usually a slice of items.
+//Each request goes through the client like any other, so the base url,
+//default headers and query and mutators all apply.
+//It stops when the strategy runs out of pages, a limit is reached or a
+//request fails. A page with a status outside of the client's success
+//range ends the walk with an *HTTPError.
+func Paginate[T any](c *Client, p *Params, opts Pagination) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var zero T
+		if opts.Strategy == nil {
+			yield(zero, errors.New("Pagination needs a Strategy."))
+			return
+		}
+		method := opts.Method
+		if method == "" {
+			method = "GET"
+		}
+
+		params := opts.Strategy.First(p)
+		total := 0
+		for number := 0; params != nil; number++ {
+			if opts.MaxPages > 0 && number >= opts.MaxPages {
+				return
+			}
+
+			value, res, err := DoAs[T](c, method, params)
+			if err != nil {
+				yield(zero, err)
+				return
+			}
+			if !c.successful(res.StatusCode) {
+				yield(zero, newHTTPError(res.Request, res, nil, nil))
+				return
+			}
+
+			items := countItems(value)
+			page := &Page{
+				Number:   number,
+				Params:   params,
+				Response: res,
+				Value:    &value,
+				Items:    items,
+				Base:     c.BaseUrl(),
+			}
+			if opts.MaxItems > 0 && items >= 0 && total+items > opts.MaxItems {
+				value = trimItems(value, opts.MaxItems-total)
+				items = opts.MaxItems - total
+			}
+			total += items
+
+			if !yield(value, nil) {
+				return
+			}
+			if opts.MaxItems > 0 && total >= opts.MaxItems {
+				return
+			}
+
+			params, err = opts.Strategy.Next(page)
+			if err != nil {
+				yield(zero, err)
+				return
+			}
+		}
+	}
+}
+
+func countItems(v interface{}) int {
+	if l, ok := v.(interface{ Len() int }); ok {
+		return l.Len()
+	}
+	rv := rt.ValueOf(v)
+	switch rv.Kind() {
+	case rt.Slice, rt.Array, rt.Map:
+		return rv.Len()
+	}
+	return -1
+}
+
+func trimItems[T any](v T, n int) T {
+	rv := rt.ValueOf(v)
+	if rv.Kind() != rt.Slice {
+		return v
+	}
+	return rv.Slice(0, n).Interface().(T)
+}
+
+//withQuery returns a copy of p with the query values in set replacing
+//its own.
+func withQuery(p *Params, set url.Values) *Params {
+	next := *p
+	next.Query = queryCopy(p.Query)
+	if next.Query == nil {
+		next.Query = make(url.Values)
+	}
+	for k, v := range set {
+		next.Query[k] = v
+	}
+	return &next
+}
+
+//LinkPages follows RFC 5988 Link headers with rel="next", like GitHub's
+//API. The next url has to be under the client's base url since it is
+//turned back into a Path and Query.
+type LinkPages struct{}
+
+func (s LinkPages) First(p *Params) *Params {
+	return p
+}
+
+func (s LinkPages) Next(page *Page) (*Params, error) {
+	next := NextLink(page.Response)
+	if next == nil {
+		return nil, nil
+	}
+
+	basePath := strings.TrimSuffix(page.Base.Path, "/")
+	if next.Host != page.Base.Host || !strings.HasPrefix(next.Path, basePath) {
+		return nil, fmt.Errorf("Next page %s is not under the base url %s.", next, page.Base)
+	}
+
+	params := *page.Params
+	params.Path = strings.TrimPrefix(next.Path, basePath)
+	params.Query = next.Query()
+	return &params, nil
+}
+
+//NextLink returns the url of the Link header with rel="next" in res,
+//resolved against the request url, or nil if there isn't one.
+func NextLink(res *http.Response) *url.URL {
+	for _, header := range res.Header.Values("Link") {
+		for _, link := range splitLinkHeader(header, ',') {
+			parts := splitLinkHeader(link, ';')
+			target := strings.TrimSpace(parts[0])
+			if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+				continue
+			}
+			for _, attr := range parts[1:] {
+				name, value, ok := strings.Cut(strings.TrimSpace(attr), "=")
+				if !ok || strings.ToLower(name) != "rel" {
+					continue
+				}
+				for _, rel := range strings.Fields(strings.Trim(value, `"`)) {
+					if strings.ToLower(rel) != "next" {
+						continue
+					}
+					u, err := url.Parse(target[1 : len(target)-1])
+					if err != nil {
+						return nil
+					}
+					if res.Request != nil {
+						u = res.Request.URL.ResolveReference(u)
+					}
+					return u
+				}
+			}
+		}
+	}
+	return nil
+}
+
+//splitLinkHeader splits a Link header at sep, skipping over the urls in
+//angle brackets and the quoted strings, which may contain it.
+func splitLinkHeader(s string, sep byte) []string {
+	var parts []string
+	var bracketed, quoted bool
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case bracketed:
+			bracketed = c != '>'
+		case quoted:
+			if c == '\\' {
+				i++
+			} else {
+				quoted = c != '"'
+			}
+		case c == '<':
+			bracketed = true
+		case c == '"':
+			quoted = true
+		case c == sep:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+//CursorPages sends the cursor for the next page in the Param query
+//parameter. The cursor comes from the Header response header when it is
+//set, otherwise from calling Cursor with the unmarshaled page.
+//An empty cursor means there are no more pages.
+type CursorPages struct {
+	Param  string
+	Header string
+	Cursor func(page interface{}) string
+}
+
+func (s CursorPages) First(p *Params) *Params {
+	return p
+}
+
+func (s CursorPages) Next(page *Page) (*Params, error) {
+	var cursor string
+	if s.Header != "" {
+		cursor = page.Response.Header.Get(s.Header)
+	} else if s.Cursor != nil {
+		cursor = s.Cursor(page.Value)
+	} else {
+		return nil, errors.New("CursorPages needs a Header or a Cursor func.")
+	}
+	if cursor == "" {
+		return nil, nil
+	}
+	return withQuery(page.Params, url.Values{s.Param: []string{cursor}}), nil
+}
+
+//OffsetPages pages with an offset query parameter, like ?offset=40&limit=20,
+//or with a page number, see PageNumbers.
+//It stops on a page with no items or, if Size is set, fewer than Size items.
+//Pages must be countable, see Page.Items.
+type OffsetPages struct {
+	//Param is the name of the offset or page number parameter.
+	Param string
+	//Start is the offset or number of the first page.
+	Start int
+	//Step is how much Param goes up for every page. It defaults to Size,
+	//or 1 if Size isn't set, so it can count pages as well as items.
+	Step int
+	//Size is the page size sent in SizeParam, if SizeParam is set.
+	Size      int
+	SizeParam string
+}
+
+//PageNumbers returns an OffsetPages for APIs counting pages from 1 with
+//the param query parameter, like ?page=3.
+func PageNumbers(param string) OffsetPages {
+	return OffsetPages{Param: param, Start: 1, Step: 1}
+}
+
+func (s OffsetPages) step() int {
+	switch {
+	case s.Step > 0:
+		return s.Step
+	case s.Size > 0:
+		return s.Size
+	}
+	return 1
+}
+
+func (s OffsetPages) First(p *Params) *Params {
+	set := url.Values{s.Param: []string{strconv.Itoa(s.Start)}}
+	if s.SizeParam != "" && s.Size > 0 {
+		set.Set(s.SizeParam, strconv.Itoa(s.Size))
+	}
+	return withQuery(p, set)
+}
+
+func (s OffsetPages) Next(page *Page) (*Params, error) {
+	if page.Items < 0 {
+		return nil, errors.New("OffsetPages needs pages that are slices, arrays, maps or have a Len method.")
+	}
+	if page.Items == 0 || (s.Size > 0 && page.Items < s.Size) {
+		return nil, nil
+	}
+	offset := s.Start + (page.Number+1)*s.step()
+	return withQuery(page.Params, url.Values{s.Param: []string{strconv.Itoa(offset)}}), nil
+}
@@ -0,0 +1,177 @@
+package grestclient
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+)
+
+func TestPaginateLinkHeader(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Query().Get("token") != "secret" {
+			t.Fatal("Default query was not sent: ", req.URL.RawQuery)
+		}
+		page, _ := strconv.Atoi(req.URL.Query().Get("page"))
+		if page == 0 {
+			page = 1
+		}
+		if page < 3 {
+			w.Header().Set("Link", fmt.Sprintf(`<%s/api/items?page=%d>; rel="next", <%s/api/items?page=3>; rel="last"`,
+				server.URL, page+1, server.URL))
+		}
+		w.Write([]byte(fmt.Sprintf(`[%d, %d]`, page*10, page*10+1)))
+	}))
+	defer server.Close()
+
+	base, err := url.Parse(server.URL + "/api")
+	client, err := New(base)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetupForJson(client)
+	client.Query().Set("token", "secret")
+
+	var items []int
+	for page, err := range Paginate[[]int](client, &Params{Path: "/items"}, Pagination{Strategy: LinkPages{}}) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		items = append(items, page...)
+	}
+	if len(items) != 6 || items[5] != 31 {
+		t.Fatal("Unexpected items: ", items)
+	}
+}
+
+func TestPaginateCursorInBody(t *testing.T) {
+	type page struct {
+		Items []string `json:"items"`
+		Next  string   `json:"next"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Query().Get("cursor") {
+		case "":
+			w.Write([]byte(`{"items":["a","b"],"next":"c1"}`))
+		case "c1":
+			w.Write([]byte(`{"items":["c"],"next":""}`))
+		default:
+			t.Fatal("Unexpected cursor: ", req.URL.RawQuery)
+		}
+	}))
+	defer server.Close()
+
+	base, err := url.Parse(server.URL)
+	client, err := New(base)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetupForJson(client)
+
+	strategy := CursorPages{Param: "cursor", Cursor: func(p interface{}) string {
+		return p.(*page).Next
+	}}
+
+	var items []string
+	for p, err := range Paginate[page](client, &Params{Path: "items"}, Pagination{Strategy: strategy}) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		items = append(items, p.Items...)
+	}
+	if len(items) != 3 {
+		t.Fatal("Unexpected items: ", items)
+	}
+}
+
+func TestPaginateOffsetWithLimits(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+		if req.URL.Query().Get("limit") != "2" {
+			t.Fatal("Page size was not sent: ", req.URL.RawQuery)
+		}
+		offset, _ := strconv.Atoi(req.URL.Query().Get("offset"))
+		w.Write([]byte(fmt.Sprintf(`[%d, %d]`, offset, offset+1)))
+	}))
+	defer server.Close()
+
+	base, err := url.Parse(server.URL)
+	client, err := New(base)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetupForJson(client)
+
+	strategy := OffsetPages{Param: "offset", Size: 2, SizeParam: "limit"}
+
+	var items []int
+	for page, err := range Paginate[[]int](client, &Params{Path: "items"}, Pagination{Strategy: strategy, MaxItems: 5}) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		items = append(items, page...)
+	}
+	if len(items) != 5 || items[4] != 4 || requests != 3 {
+		t.Fatal("Unexpected items: ", items, requests)
+	}
+
+	requests = 0
+	for _, err := range Paginate[[]int](client, &Params{Path: "items"}, Pagination{Strategy: strategy, MaxPages: 2}) {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if requests != 2 {
+		t.Fatal("Expected 2 pages but got: ", requests)
+	}
+}
+
+func TestPaginateStopsOnErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	base, err := url.Parse(server.URL)
+	client, err := New(base)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, err := range Paginate[[]int](client, &Params{Path: "items"}, Pagination{Strategy: PageNumbers("page")}) {
+		if !IsForbidden(err) {
+			t.Fatal("Expected a forbidden error but got: ", err)
+		}
+	}
+}
+
+func TestNextLinkWithCommas(t *testing.T) {
+	request, _ := http.NewRequest("GET", "https://h/x", nil)
+	links := []struct {
+		header string
+		next   string
+	}{
+		{`<https://h/x?fields=a,b&page=2>; rel="next"`, "https://h/x?fields=a,b&page=2"},
+		{`<https://h/x?page=1>; rel="prev"; title="a, b; c", <https://h/x?fields=a,b&page=3>; rel="next"`, "https://h/x?fields=a,b&page=3"},
+		{`</x?page=4;v=1>; rel="next last"`, "https://h/x?page=4;v=1"},
+		{`<https://h/x?page=1>; rel="prev"`, ""},
+	}
+	for _, link := range links {
+		res := &http.Response{Header: http.Header{"Link": {link.header}}, Request: request}
+		next := ""
+		if u := NextLink(res); u != nil {
+			next = u.String()
+		}
+		if next != link.next {
+			t.Fatal("Wrong next link for ", link.header, ": ", next)
+		}
+	}
+}
@@ -0,0 +1,344 @@
+package grestclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+//DefaultRetryStatusCodes are the response codes retried when a
+//RetryPolicy doesn't list its own.
+var DefaultRetryStatusCodes = []int{
+	http.StatusTooManyRequests,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+//RetryPolicy tells the client when and how often to try a request
+//again after a transport error or a retryable response code.
+//Set it on a client with SetRetryPolicy. A policy should not be changed
+//once it has been set since clones of the client share it.
+type RetryPolicy struct {
+	//MaxAttempts is the total number of attempts including the first one.
+	//0 or 1 means requests are not retried.
+	MaxAttempts int
+
+	//MinBackoff is the wait before the second attempt. It doubles for every
+	//attempt after that up to MaxBackoff. Half of each wait is random jitter
+	//so clients don't retry in lockstep.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	//StatusCodes are the response codes that get retried.
+	//If nil DefaultRetryStatusCodes is used.
+	StatusCodes []int
+
+	//RetryableError decides if a transport error from the HttpDoer should
+	//be retried. If nil IsRetryableError is used.
+	//Errors caused by the request's Context are never retried.
+	RetryableError func(error) bool
+
+	//NonIdempotent allows retrying POST, PATCH and other methods that are not
+	//idempotent. By default only GET, HEAD, OPTIONS, TRACE, PUT and DELETE
+	//are retried.
+	NonIdempotent bool
+
+	//MaxRetryAfter caps how long a Retry-After header may make the client wait.
+	//If the server asks for a longer wait the response is returned instead
+	//of being retried. 0 means there is no cap.
+	MaxRetryAfter time.Duration
+}
+
+//DefaultRetryPolicy returns a policy with 3 attempts and a backoff
+//between 100ms and 2s.
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts: 3,
+		MinBackoff:  100 * time.Millisecond,
+		MaxBackoff:  2 * time.Second,
+	}
+}
+
+//RetryError is returned when a request that was attempted more than
+//once still failed. Err is the error from the last attempt.
+//
+//It is also returned together with the last response when the attempts
+//ran out on a status the policy retries, like three 503s in a row. Err
+//is then the *HTTPError for that response, even if no SuccessRange is
+//set, so StatusCode and IsRetryable work on it.
+type RetryError struct {
+	Attempts int
+	Err      error
+}
+
+func (e *RetryError) Error() string {
+	return fmt.Sprintf("grestclient: giving up after %d attempts: %v", e.Attempts, e.Err)
+}
+
+func (e *RetryError) Unwrap() error {
+	return e.Err
+}
+
+//IsRetryableError reports whether err from an HttpDoer looks temporary:
+//timeouts, refused or reset connections and connections closed
+//before the response was read.
+func IsRetryableError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+//SetRetryPolicy sets the policy used to retry requests.
+//Pass nil to turn retries off, which is the default.
+func (c *Client) SetRetryPolicy(p *RetryPolicy) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.retry = p
+}
+
+//RetryPolicy returns the retry policy being used or nil if requests
+//are not retried.
+func (c *Client) RetryPolicy() *RetryPolicy {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.retry
+}
+
+//idempotent reports whether a request with the method can be safely
+//sent more than once.
+func idempotent(method string) bool {
+	switch method {
+	case "GET", "HEAD", "OPTIONS", "TRACE", "PUT", "DELETE":
+		return true
+	}
+	return false
+}
+
+func (p *RetryPolicy) retryStatus(code int) bool {
+	codes := p.StatusCodes
+	if codes == nil {
+		codes = DefaultRetryStatusCodes
+	}
+	for _, c := range codes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *RetryPolicy) retryError(err error) bool {
+	if p.RetryableError != nil {
+		return p.RetryableError(err)
+	}
+	return IsRetryableError(err)
+}
+
+//backoff returns the wait before the attempt following attempt.
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.MinBackoff
+	for i := 1; i < attempt && (p.MaxBackoff <= 0 || d < p.MaxBackoff); i++ {
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(d-half)+1))
+}
+
+//retryAfter parses the Retry-After header of res which is either a number
+//of seconds or an http date.
+func retryAfter(res *http.Response) (time.Duration, bool) {
+	v := res.Header.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		if secs < 0 {
+			secs = 0
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		d := time.Until(t)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return 0, false
+}
+
+//roundTrip sends r with the HttpDoer, retrying according to the
+//client's RetryPolicy.
+func (c *Client) roundTrip(r *http.Request) (*http.Response, error) {
+	ctx := r.Context()
+	doer := c.httpDoer()
+	policy := c.retry
+
+	if policy == nil || policy.MaxAttempts <= 1 ||
+		(!policy.NonIdempotent && !idempotent(r.Method)) ||
+		(r.Body != nil && r.Body != http.NoBody && r.GetBody == nil) {
+		setAttempts(ctx, 1)
+		response, err := c.send(doer, r)
+		if err != nil {
+			return nil, canceled(ctx, err)
+		}
+		return response, nil
+	}
+
+	for attempt := 1; ; attempt++ {
+		setAttempts(ctx, attempt)
+		response, err := c.send(doer, r)
+
+		wait, again := policy.shouldRetry(ctx, attempt, response, err)
+		if !again {
+			if err != nil {
+				err = canceled(ctx, err)
+				if attempt > 1 {
+					err = &RetryError{Attempts: attempt, Err: err}
+				}
+				return nil, err
+			}
+			return response, nil
+		}
+
+		if response != nil {
+			discard(response.Body)
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, &RetryError{Attempts: attempt, Err: canceled(ctx, ctx.Err())}
+		case <-timer.C:
+		}
+
+		next := r.Clone(ctx)
+		if r.GetBody != nil {
+			body, err := r.GetBody()
+			if err != nil {
+				return nil, &RetryError{Attempts: attempt, Err: err}
+			}
+			next.Body = body
+		}
+		r = next
+	}
+}
+
+//gaveUp tells if response is the last of several attempts and has a
+//status the policy retries.
+func (c *Client) gaveUp(attempts int, response *http.Response) bool {
+	return c.retry != nil && attempts > 1 && c.retry.retryStatus(response.StatusCode)
+}
+
+type attemptsKey struct{}
+
+//discard reads what is left of a body that isn't wanted, so the
+//connection can be reused, and closes it. Bodies bigger than
+//ErrorBodySnapshotSize, like big error pages or streams, are just closed.
+func discard(body io.ReadCloser) {
+	io.Copy(ioutil.Discard, io.LimitReader(body, ErrorBodySnapshotSize))
+	body.Close()
+}
+
+//countAttempts returns a copy of r with a counter that roundTrip keeps
+//up to date with the number of attempts made to send it. A counter r
+//already has is shared.
+func countAttempts(r *http.Request) (*http.Request, *int) {
+	if n, ok := r.Context().Value(attemptsKey{}).(*int); ok {
+		return r, n
+	}
+	n := new(int)
+	return r.WithContext(context.WithValue(r.Context(), attemptsKey{}, n)), n
+}
+
+//detach returns a context with the values and deadline of ctx that isn't
+//canceled with it, for a request that outlives the one it was made for.
+//It gets its own attempt counter.
+func detach(ctx context.Context) (context.Context, context.CancelFunc) {
+	detached := context.WithValue(context.WithoutCancel(ctx), attemptsKey{}, new(int))
+	if deadline, ok := ctx.Deadline(); ok {
+		return context.WithDeadline(detached, deadline)
+	}
+	return context.WithCancel(detached)
+}
+
+func setAttempts(ctx context.Context, attempt int) {
+	if n, ok := ctx.Value(attemptsKey{}).(*int); ok {
+		*n = attempt
+	}
+}
+
+//send makes a single attempt at r with doer, going through the client's
+//CircuitBreaker and RateLimiter for r if there are any.
+func (c *Client) send(doer HttpDoer, r *http.Request) (*http.Response, error) {
+	var done func(*http.Response, error)
+	if b := c.breakerFor(r); b != nil {
+		var err error
+		if done, err = b.allow(); err != nil {
+			return nil, err
+		}
+	}
+
+	var response *http.Response
+	var err error
+	if l := c.limiterFor(r); l != nil {
+		response, err = l.limit(doer, r)
+	} else {
+		response, err = doer.Do(r)
+	}
+	if done != nil {
+		done(response, err)
+	}
+	return response, err
+}
+
+//shouldRetry decides if another attempt should be made after attempt
+//produced response or err, and how long to wait before making it.
+func (p *RetryPolicy) shouldRetry(ctx context.Context, attempt int, response *http.Response, err error) (time.Duration, bool) {
+	if attempt >= p.MaxAttempts {
+		return 0, false
+	}
+	if err != nil {
+		if ctx.Err() != nil || !p.retryError(err) {
+			return 0, false
+		}
+		return p.backoff(attempt), true
+	}
+	if !p.retryStatus(response.StatusCode) {
+		return 0, false
+	}
+	if after, ok := retryAfter(response); ok {
+		if p.MaxRetryAfter > 0 && after > p.MaxRetryAfter {
+			return 0, false
+		}
+		return after, true
+	}
+	return p.backoff(attempt), true
+}
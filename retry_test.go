@@ -0,0 +1,228 @@
+package grestclient
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestRetryOnStatusRewindsBody(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		attempts++
+		b, _ := ioutil.ReadAll(req.Body)
+		if string(b) != "hello" {
+			t.Fatal("Body was not rewound for attempt ", attempts, ": ", string(b))
+		}
+		if attempts < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("world"))
+	}))
+	defer server.Close()
+
+	base, err := url.Parse(server.URL)
+	client, err := New(base)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.SetRetryPolicy(&RetryPolicy{MaxAttempts: 3, MinBackoff: time.Millisecond})
+
+	var success string
+	res, err := client.Put(&Params{
+		Path:         "put",
+		Body:         "hello",
+		UnmarshalMap: UnmarshalMap{200: &success},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusOK || success != "world" {
+		t.Fatal("Unexpected response: ", res.StatusCode, success)
+	}
+	if attempts != 3 {
+		t.Fatal("Expected 3 attempts but got: ", attempts)
+	}
+}
+
+func TestRetryGivesUpAndReturnsLastResponse(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		attempts++
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	base, err := url.Parse(server.URL)
+	client, err := New(base)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.SetRetryPolicy(&RetryPolicy{MaxAttempts: 2, MinBackoff: time.Hour})
+
+	res, err := client.Get(&Params{Path: "get"})
+	var retryErr *RetryError
+	if !errors.As(err, &retryErr) || retryErr.Attempts != 2 || StatusCode(err) != http.StatusTooManyRequests {
+		t.Fatal("Expected a RetryError for the last status: ", err)
+	}
+	if res == nil || res.StatusCode != http.StatusTooManyRequests {
+		t.Fatal("Unexpected response: ", res)
+	}
+	if attempts != 2 {
+		t.Fatal("Expected 2 attempts but got: ", attempts)
+	}
+
+	//with status errors on the HTTPError is wrapped
+	attempts = 0
+	client.SetRetryPolicy(&RetryPolicy{MaxAttempts: 3, MinBackoff: time.Hour})
+	client.SetSuccessRange(DefaultSuccessRange)
+	res, err = client.Get(&Params{Path: "get"})
+	var httpErr *HTTPError
+	if !errors.As(err, &retryErr) || retryErr.Attempts != 3 || !errors.As(err, &httpErr) ||
+		httpErr.StatusCode != http.StatusTooManyRequests || res == nil {
+		t.Fatal("Expected a RetryError wrapping the HTTPError: ", err)
+	}
+
+	//a single attempt is not wrapped
+	client.SetRetryPolicy(&RetryPolicy{MaxAttempts: 1})
+	if _, err = client.Get(&Params{Path: "get"}); errors.As(err, &retryErr) || !errors.As(err, &httpErr) {
+		t.Fatal("Expected a plain HTTPError: ", err)
+	}
+}
+
+func TestRetryNotUsedForPostByDefault(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	base, err := url.Parse(server.URL)
+	client, err := New(base)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.SetRetryPolicy(&RetryPolicy{MaxAttempts: 3})
+
+	client.Post(&Params{Path: "post", Body: "hello"})
+	if attempts != 1 {
+		t.Fatal("POST should not be retried by default but got attempts: ", attempts)
+	}
+
+	client.SetRetryPolicy(&RetryPolicy{MaxAttempts: 3, NonIdempotent: true})
+	attempts = 0
+	client.Post(&Params{Path: "post", Body: "hello"})
+	if attempts != 3 {
+		t.Fatal("Expected POST to be retried but got attempts: ", attempts)
+	}
+}
+
+func TestRetryErrorReportsAttempts(t *testing.T) {
+	base, err := url.Parse("http://127.0.0.1:9999")
+	client, err := New(base)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.SetRetryPolicy(&RetryPolicy{
+		MaxAttempts:    3,
+		RetryableError: func(error) bool { return true },
+	})
+
+	_, err = client.Get(&Params{Path: "get"})
+	var retryErr *RetryError
+	if !errors.As(err, &retryErr) {
+		t.Fatal("Expected a RetryError but got: ", err)
+	}
+	if retryErr.Attempts != 3 {
+		t.Fatal("Expected 3 attempts but got: ", retryErr.Attempts)
+	}
+}
+
+func TestRetryStopsWhenContextIsDone(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	base, err := url.Parse(server.URL)
+	client, err := New(base)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.SetRetryPolicy(&RetryPolicy{MaxAttempts: 5, MinBackoff: time.Hour})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err = client.Get(&Params{Path: "get", Context: ctx})
+	if !errors.Is(err, ErrCanceled) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal("Expected a canceled error but got: ", err)
+	}
+}
+
+func TestRetryAfterParsing(t *testing.T) {
+	res := &http.Response{Header: http.Header{}}
+	if _, ok := retryAfter(res); ok {
+		t.Fatal("Did not expect a Retry-After without the header.")
+	}
+
+	res.Header.Set("Retry-After", "7")
+	if d, ok := retryAfter(res); !ok || d != 7*time.Second {
+		t.Fatal("Unexpected Retry-After in seconds: ", d)
+	}
+
+	res.Header.Set("Retry-After", time.Now().Add(time.Minute).UTC().Format(http.TimeFormat))
+	if d, ok := retryAfter(res); !ok || d <= 0 || d > time.Minute {
+		t.Fatal("Unexpected Retry-After as a date: ", d)
+	}
+}
+
+func TestRetryDoesNotReadBigBodies(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		attempts++
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		if attempts > 1 {
+			return
+		}
+		//a body that doesn't end until the client goes away
+		stop := time.After(5 * time.Second)
+		for {
+			select {
+			case <-req.Context().Done():
+				return
+			case <-stop:
+				return
+			default:
+			}
+			w.Write(make([]byte, 1024))
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer server.Close()
+
+	base, _ := url.Parse(server.URL)
+	client, _ := New(base)
+	client.SetHttpDoer(&http.Client{})
+	client.SetRetryPolicy(&RetryPolicy{MaxAttempts: 2})
+
+	start := time.Now()
+	client.Get(&Params{Path: "get"})
+	if elapsed := time.Since(start); elapsed > 2*time.Second || attempts != 2 {
+		t.Fatal("The body of a retried response should not be read to the end: ", elapsed, attempts)
+	}
+}
@@ -0,0 +1,274 @@
+package grestclient
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//UnsignedPayload is sent instead of the body hash when a SigV4Auth
+//doesn't sign the body.
+const UnsignedPayload = "UNSIGNED-PAYLOAD"
+
+var errSigV4NoHost = errors.New("Can't sign a request without a host.")
+
+const (
+	sigV4Algorithm  = "AWS4-HMAC-SHA256"
+	sigV4TimeFormat = "20060102T150405Z"
+)
+
+//SigV4Auth signs requests with AWS Signature Version 4, the scheme used
+//by AWS and by S3 compatible stores like MinIO. It signs the request as
+//it will be sent, after the body has been marshaled and the
+//RequestMutators have run, so the path, query, headers and body hash are
+//exactly those of the request.
+//
+//The body is hashed through GetBody so it must be able to be read
+//again, unless UnsignedPayload is set.
+//
+//When the Service is "s3" or the payload is unsigned the body hash is
+//sent in the X-Amz-Content-Sha256 header, which S3 wants. S3 paths are
+//also signed as they are instead of being normalized and escaped twice
+//like other services want.
+type SigV4Auth struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	//SessionToken is sent in X-Amz-Security-Token for temporary credentials.
+	SessionToken string
+	Region       string
+	Service      string
+
+	//UnsignedPayload signs UNSIGNED-PAYLOAD instead of the body hash.
+	UnsignedPayload bool
+
+	//Expires turns on presigning when it is more than 0. The signature
+	//goes in the query instead of the Authorization header and is valid
+	//for this long. Presigned requests always have an unsigned payload.
+	Expires time.Duration
+
+	//Now defaults to time.Now. Useful for tests.
+	Now func() time.Time
+}
+
+//Authenticate signs r in the Authorization header, or in the query if
+//Expires is set.
+func (a SigV4Auth) Authenticate(r *http.Request) error {
+	if a.Expires > 0 {
+		return a.presign(r)
+	}
+	return a.sign(r)
+}
+
+//PresignURL builds the request for method and p the way c would send it
+//and returns its url presigned to be valid for a.Expires, or 15 minutes if
+//it isn't set. Nothing is sent. The url can be handed to something else,
+//like a browser, to perform the request without the credentials.
+func (a SigV4Auth) PresignURL(c *Client, method string, p *Params) (*url.URL, error) {
+	if a.Expires <= 0 {
+		a.Expires = 15 * time.Minute
+	}
+	c = c.snapshot()
+	r, err := c.prepareRequest(p.context(), method, p.Path, p.Headers, p.Query, p.Body)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range c.reqMutators {
+		if err = m(r); err != nil {
+			return nil, err
+		}
+	}
+	if err = a.presign(r); err != nil {
+		return nil, err
+	}
+	return r.URL, nil
+}
+
+func (a SigV4Auth) now() time.Time {
+	if a.Now != nil {
+		return a.Now().UTC()
+	}
+	return time.Now().UTC()
+}
+
+func (a SigV4Auth) scope(t time.Time) string {
+	return strings.Join([]string{t.Format("20060102"), a.Region, a.Service, "aws4_request"}, "/")
+}
+
+func (a SigV4Auth) sign(r *http.Request) error {
+	if sigV4Host(r) == "" {
+		return errSigV4NoHost
+	}
+	t := a.now()
+
+	payload := UnsignedPayload
+	if !a.UnsignedPayload {
+		var err error
+		if payload, err = BodySHA256(r); err != nil {
+			return err
+		}
+	}
+
+	r.Header.Del("Authorization")
+	r.Header.Set("X-Amz-Date", t.Format(sigV4TimeFormat))
+	if a.SessionToken != "" {
+		r.Header.Set("X-Amz-Security-Token", a.SessionToken)
+	}
+	if a.Service == "s3" || a.UnsignedPayload {
+		r.Header.Set("X-Amz-Content-Sha256", payload)
+	}
+
+	headers := sigV4Headers(r, true)
+	signature := a.signature(t, SigV4CanonicalRequest(r, headers, payload, a.Service == "s3"))
+	r.Header.Set("Authorization", sigV4Algorithm+
+		" Credential="+a.AccessKeyID+"/"+a.scope(t)+
+		", SignedHeaders="+strings.Join(headers, ";")+
+		", Signature="+signature)
+	return nil
+}
+
+func (a SigV4Auth) presign(r *http.Request) error {
+	if sigV4Host(r) == "" {
+		return errSigV4NoHost
+	}
+	t := a.now()
+	headers := sigV4Headers(r, false)
+
+	q := r.URL.Query()
+	q.Set("X-Amz-Algorithm", sigV4Algorithm)
+	q.Set("X-Amz-Credential", a.AccessKeyID+"/"+a.scope(t))
+	q.Set("X-Amz-Date", t.Format(sigV4TimeFormat))
+	q.Set("X-Amz-Expires", strconv.FormatInt(int64(a.Expires/time.Second), 10))
+	q.Set("X-Amz-SignedHeaders", strings.Join(headers, ";"))
+	if a.SessionToken != "" {
+		q.Set("X-Amz-Security-Token", a.SessionToken)
+	}
+	q.Del("X-Amz-Signature")
+	r.URL.RawQuery = canonicalQuery(q)
+
+	signature := a.signature(t, SigV4CanonicalRequest(r, headers, UnsignedPayload, a.Service == "s3"))
+	r.URL.RawQuery += "&X-Amz-Signature=" + signature
+	return nil
+}
+
+//signature returns the hex encoded signature of canonicalRequest.
+func (a SigV4Auth) signature(t time.Time, canonicalRequest string) string {
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		sigV4Algorithm,
+		t.Format(sigV4TimeFormat),
+		a.scope(t),
+		hex.EncodeToString(hash[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+a.SecretAccessKey), t.Format("20060102"))
+	key = hmacSHA256(key, a.Region)
+	key = hmacSHA256(key, a.Service)
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+//sigV4Headers returns the sorted lower case names of the headers to sign.
+//The host is always signed and the other headers of r only if all is true.
+func sigV4Headers(r *http.Request, all bool) []string {
+	headers := []string{"host"}
+	if !all {
+		return headers
+	}
+	for name := range r.Header {
+		switch name = strings.ToLower(name); name {
+		case "host", "authorization", "user-agent", "expect", "x-amzn-trace-id":
+			continue
+		}
+		headers = append(headers, name)
+	}
+	sort.Strings(headers)
+	return headers
+}
+
+//SigV4CanonicalRequest returns the canonical request SigV4Auth signs for
+//r. headers are the lower case names of the signed headers, sorted, and
+//payload is the hex encoded sha256 of the body or UnsignedPayload. S3
+//paths are used as they are while other services have them normalized.
+//Servers can use it to check signatures.
+func SigV4CanonicalRequest(r *http.Request, headers []string, payload string, s3 bool) string {
+	var canonicalHeaders strings.Builder
+	for _, name := range headers {
+		var value string
+		if name == "host" {
+			value = sigV4Host(r)
+		} else {
+			var values []string
+			for _, v := range r.Header.Values(name) {
+				values = append(values, strings.Join(strings.Fields(v), " "))
+			}
+			value = strings.Join(values, ",")
+		}
+		canonicalHeaders.WriteString(name + ":" + value + "\n")
+	}
+
+	q := r.URL.Query()
+	q.Del("X-Amz-Signature")
+
+	return strings.Join([]string{
+		r.Method,
+		sigV4Path(r.URL.Path, s3),
+		canonicalQuery(q),
+		canonicalHeaders.String(),
+		strings.Join(headers, ";"),
+		payload,
+	}, "\n")
+}
+
+//sigV4Host returns the host of r without the port when it is the default
+//one for the scheme.
+func sigV4Host(r *http.Request) string {
+	host := r.Host
+	if host == "" {
+		host = r.URL.Host
+	}
+	h, port, err := net.SplitHostPort(host)
+	if err == nil && ((port == "80" && r.URL.Scheme == "http") || (port == "443" && r.URL.Scheme == "https")) {
+		return h
+	}
+	return host
+}
+
+//sigV4Path escapes p once for S3 and normalizes and escapes it twice for
+//other services.
+func sigV4Path(p string, s3 bool) string {
+	if p == "" {
+		return "/"
+	}
+	if !s3 {
+		clean := path.Clean("/" + p)
+		if strings.HasSuffix(p, "/") && clean != "/" {
+			clean += "/"
+		}
+		p = clean
+	}
+
+	segments := strings.Split(p, "/")
+	for i, s := range segments {
+		s = queryEscape(s)
+		if !s3 {
+			s = queryEscape(s)
+		}
+		segments[i] = s
+	}
+	return strings.Join(segments, "/")
+}
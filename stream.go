@@ -0,0 +1,79 @@
+package grestclient
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+//Stream is a request body that is sent while it is being read instead
+//of going through the MarshalerFunc and being held in memory as a
+//ReadLener. Use it as Params.Body to upload big files or pipe the output
+//of another process.
+//
+//If Length is known it is sent as the Content-Length. Otherwise the
+//body is sent with chunked transfer encoding. APIs that need an exact
+//Content-Length, like ArangoDB's, should keep using the ReadLener path or
+//give the Length.
+type Stream struct {
+	//Reader is read once for the body. It is closed after the request
+	//if it is an io.Closer.
+	Reader io.Reader
+
+	//Open returns a fresh reader for the body. When it is set the
+	//request can be retried or redirected because the body can be sent
+	//again. If Reader is nil Open is also used for the first attempt.
+	Open func() (io.ReadCloser, error)
+
+	//Length is the number of bytes in the body. 0 or less means it is unknown.
+	Length int64
+
+	//ContentType is set as the request's Content-Type if not empty.
+	ContentType string
+}
+
+//NewStream returns a Stream reading r once. Pass -1 as length when it
+//isn't known.
+func NewStream(r io.Reader, length int64) *Stream {
+	return &Stream{Reader: r, Length: length}
+}
+
+//NewStreamFunc returns a Stream that calls open for every attempt
+//so the request can be retried. Pass -1 as length when it isn't known.
+func NewStreamFunc(open func() (io.ReadCloser, error), length int64) *Stream {
+	return &Stream{Open: open, Length: length}
+}
+
+//setup makes s the body of r.
+func (s *Stream) setup(r *http.Request) error {
+	var body io.ReadCloser
+	switch {
+	case s.Reader != nil:
+		if rc, ok := s.Reader.(io.ReadCloser); ok {
+			body = rc
+		} else {
+			body = ioutil.NopCloser(s.Reader)
+		}
+	case s.Open != nil:
+		var err error
+		if body, err = s.Open(); err != nil {
+			return err
+		}
+	default:
+		return errors.New("Stream needs either a Reader or an Open func.")
+	}
+
+	r.Body = body
+	r.GetBody = s.Open
+	if s.Length > 0 {
+		r.ContentLength = s.Length
+	} else {
+		r.ContentLength = -1
+	}
+
+	if s.ContentType != "" {
+		r.Header.Set("Content-Type", s.ContentType)
+	}
+	return nil
+}
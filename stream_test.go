@@ -0,0 +1,108 @@
+package grestclient
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStreamUnknownLengthIsChunked(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if len(req.TransferEncoding) == 0 || req.TransferEncoding[0] != "chunked" {
+			t.Fatal("Expected a chunked body but got: ", req.TransferEncoding, req.ContentLength)
+		}
+		b, _ := ioutil.ReadAll(req.Body)
+		if string(b) != "piped data" {
+			t.Fatal("Unexpected body: ", string(b))
+		}
+	}))
+	defer server.Close()
+
+	base, err := url.Parse(server.URL)
+	client, err := New(base)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.Write([]byte("piped "))
+		pw.Write([]byte("data"))
+		pw.Close()
+	}()
+
+	_, err = client.Post(&Params{Path: "upload", Body: NewStream(pr, -1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStreamKnownLength(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.ContentLength != 5 {
+			t.Fatal("Expected a Content-Length of 5 but got: ", req.ContentLength)
+		}
+		if req.Header.Get("Content-Type") != "application/octet-stream" {
+			t.Fatal("Unexpected Content-Type: ", req.Header.Get("Content-Type"))
+		}
+	}))
+	defer server.Close()
+
+	base, err := url.Parse(server.URL)
+	client, err := New(base)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.Put(&Params{Path: "upload", Body: &Stream{
+		Reader:      strings.NewReader("hello"),
+		Length:      5,
+		ContentType: "application/octet-stream",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStreamFuncIsReopenedForRetries(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		attempts++
+		b, _ := ioutil.ReadAll(req.Body)
+		if string(b) != "again" {
+			t.Fatal("Body was not reopened for attempt ", attempts, ": ", string(b))
+		}
+		if attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	base, err := url.Parse(server.URL)
+	client, err := New(base)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.SetRetryPolicy(&RetryPolicy{MaxAttempts: 2, MinBackoff: time.Millisecond})
+
+	opened := 0
+	_, err = client.Put(&Params{Path: "upload", Body: NewStreamFunc(func() (io.ReadCloser, error) {
+		opened++
+		return ioutil.NopCloser(bytes.NewBufferString("again")), nil
+	}, -1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attempts != 2 || opened != 2 {
+		t.Fatal("Expected 2 attempts and 2 opens but got: ", attempts, opened)
+	}
+}
@@ -0,0 +1,206 @@
+package grestclient
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+//Attribute is a key value pair describing a span or a measurement, like
+//"http.request.method" = "GET". Values are strings, ints or floats.
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+//SpanContext identifies a span for W3C trace context propagation.
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Sampled bool
+}
+
+//IsValid reports whether the trace and span ids are set.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+//TraceParent returns the value of the traceparent header for sc.
+func (sc SpanContext) TraceParent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + hex.EncodeToString(sc.TraceID[:]) + "-" + hex.EncodeToString(sc.SpanID[:]) + "-" + flags
+}
+
+//Tracer starts client spans. Adapting an OpenTelemetry trace.Tracer only
+//takes a few lines.
+type Tracer interface {
+	//Start starts a client span, a child of the span in ctx if there is
+	//one, and returns a context holding it.
+	Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span)
+}
+
+//Span is a span started by a Tracer.
+type Span interface {
+	SpanContext() SpanContext
+	SetAttributes(attrs ...Attribute)
+	//SetError marks the span as failed.
+	SetError(err error)
+	End()
+}
+
+//Meter creates the instruments used to record metrics.
+type Meter interface {
+	Int64Counter(name string, unit string) Int64Counter
+	Int64UpDownCounter(name string, unit string) Int64Counter
+	Float64Histogram(name string, unit string) Float64Histogram
+}
+
+//Int64Counter adds up values. An up down counter can also go down.
+type Int64Counter interface {
+	Add(ctx context.Context, n int64, attrs ...Attribute)
+}
+
+//Float64Histogram records a distribution of values.
+type Float64Histogram interface {
+	Record(ctx context.Context, v float64, attrs ...Attribute)
+}
+
+//Telemetry configures TelemetryMiddleware. Either can be nil.
+type Telemetry struct {
+	Tracer Tracer
+	Meter  Meter
+}
+
+//Metric names recorded by TelemetryMiddleware, following the OpenTelemetry
+//HTTP semantic conventions where there is one.
+const (
+	MetricRequests        = "http.client.requests"
+	MetricRequestDuration = "http.client.request.duration"
+	MetricActiveRequests  = "http.client.active_requests"
+)
+
+//TelemetryMiddleware traces and measures requests.
+//
+//A client span named after the method is started for every request and
+//its W3C traceparent header is sent with the request. The span gets the
+//HTTP semantic convention attributes http.request.method, url.full,
+//server.address, server.port, http.response.status_code,
+//http.request.resend_count and error.type. Responses with a 4xx or 5xx
+//status and failed requests mark the span as failed. The span ends once
+//the response headers are in.
+//
+//With a Meter it counts requests in http.client.requests, records their
+//duration in seconds in the http.client.request.duration histogram and
+//how many are being made in the http.client.active_requests up down
+//counter.
+func TelemetryMiddleware(t Telemetry) Middleware {
+	var requests, active Int64Counter
+	var duration Float64Histogram
+	if t.Meter != nil {
+		requests = t.Meter.Int64Counter(MetricRequests, "{request}")
+		active = t.Meter.Int64UpDownCounter(MetricActiveRequests, "{request}")
+		duration = t.Meter.Float64Histogram(MetricRequestDuration, "s")
+	}
+
+	return func(next Handler) Handler {
+		return func(r *http.Request, p *Params) (*http.Response, error) {
+			host, port := serverAddress(r)
+			attrs := []Attribute{
+				{"http.request.method", r.Method},
+				{"server.address", host},
+				{"server.port", port},
+			}
+
+			ctx := r.Context()
+			var span Span
+			if t.Tracer != nil {
+				ctx, span = t.Tracer.Start(ctx, r.Method,
+					append(attrs, Attribute{"url.full", r.URL.Redacted()})...)
+				r = r.WithContext(ctx)
+				if sc := span.SpanContext(); sc.IsValid() {
+					r.Header.Set("traceparent", sc.TraceParent())
+				}
+			}
+			if active != nil {
+				active.Add(ctx, 1, attrs...)
+			}
+
+			r, attempts := countAttempts(r)
+			start := time.Now()
+			response, err := next(r, p)
+			elapsed := time.Since(start)
+
+			if response != nil {
+				attrs = append(attrs, Attribute{"http.response.status_code", response.StatusCode})
+			}
+			switch {
+			case err != nil:
+				attrs = append(attrs, Attribute{"error.type", errorType(err)})
+			case response != nil && response.StatusCode >= 400:
+				attrs = append(attrs, Attribute{"error.type", strconv.Itoa(response.StatusCode)})
+			}
+
+			if span != nil {
+				spanAttrs := append([]Attribute(nil), attrs[3:]...)
+				if *attempts > 1 {
+					spanAttrs = append(spanAttrs, Attribute{"http.request.resend_count", *attempts - 1})
+				}
+				span.SetAttributes(spanAttrs...)
+				if err != nil {
+					span.SetError(err)
+				} else if response != nil && response.StatusCode >= 400 {
+					span.SetError(newHTTPError(r, response, nil, nil))
+				}
+				span.End()
+			}
+			if active != nil {
+				active.Add(ctx, -1, attrs[:3]...)
+			}
+			if requests != nil {
+				requests.Add(ctx, 1, attrs...)
+				duration.Record(ctx, elapsed.Seconds(), attrs...)
+			}
+			return response, err
+		}
+	}
+}
+
+//serverAddress returns the host and port r is sent to.
+func serverAddress(r *http.Request) (string, int) {
+	host, port, err := net.SplitHostPort(r.URL.Host)
+	if err != nil {
+		host = r.URL.Host
+		switch r.URL.Scheme {
+		case "https":
+			return host, 443
+		default:
+			return host, 80
+		}
+	}
+	n, _ := strconv.Atoi(port)
+	return host, n
+}
+
+//errorType returns a short low cardinality name for err.
+func errorType(err error) string {
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, ErrCanceled):
+		return "canceled"
+	case errors.Is(err, ErrCircuitOpen):
+		return "circuit_open"
+	case errors.Is(err, ErrRateLimited):
+		return "rate_limited"
+	case IsRetryableError(err):
+		return "transport"
+	}
+	return "_OTHER"
+}
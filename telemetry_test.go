@@ -0,0 +1,177 @@
+package grestclient
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+type memorySpan struct {
+	name    string
+	context SpanContext
+	parent  SpanContext
+	attrs   map[string]interface{}
+	err     error
+	ended   bool
+}
+
+func (s *memorySpan) SpanContext() SpanContext { return s.context }
+func (s *memorySpan) SetError(err error)       { s.err = err }
+func (s *memorySpan) End()                     { s.ended = true }
+func (s *memorySpan) SetAttributes(attrs ...Attribute) {
+	for _, a := range attrs {
+		s.attrs[a.Key] = a.Value
+	}
+}
+
+type memorySpanKey struct{}
+
+type memoryTracer struct {
+	mu    sync.Mutex
+	spans []*memorySpan
+}
+
+func (t *memoryTracer) Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	span := &memorySpan{name: name, attrs: map[string]interface{}{}}
+	span.context.SpanID[7] = byte(len(t.spans) + 1)
+	span.context.TraceID[15] = 1
+	span.context.Sampled = true
+	if parent, ok := ctx.Value(memorySpanKey{}).(*memorySpan); ok {
+		span.parent = parent.context
+	}
+	span.SetAttributes(attrs...)
+	t.spans = append(t.spans, span)
+	return context.WithValue(ctx, memorySpanKey{}, span), span
+}
+
+type memoryMeter struct {
+	mu     sync.Mutex
+	values map[string][]float64
+	attrs  map[string][]map[string]interface{}
+}
+
+type memoryInstrument struct {
+	meter *memoryMeter
+	name  string
+}
+
+func (i memoryInstrument) Add(ctx context.Context, n int64, attrs ...Attribute) {
+	i.Record(ctx, float64(n), attrs...)
+}
+
+func (i memoryInstrument) Record(ctx context.Context, v float64, attrs ...Attribute) {
+	i.meter.mu.Lock()
+	defer i.meter.mu.Unlock()
+	m := map[string]interface{}{}
+	for _, a := range attrs {
+		m[a.Key] = a.Value
+	}
+	i.meter.values[i.name] = append(i.meter.values[i.name], v)
+	i.meter.attrs[i.name] = append(i.meter.attrs[i.name], m)
+}
+
+func (m *memoryMeter) Int64Counter(name string, unit string) Int64Counter {
+	return memoryInstrument{m, name}
+}
+
+func (m *memoryMeter) Int64UpDownCounter(name string, unit string) Int64Counter {
+	return memoryInstrument{m, name}
+}
+
+func (m *memoryMeter) Float64Histogram(name string, unit string) Float64Histogram {
+	return memoryInstrument{m, name}
+}
+
+func TestTelemetryMiddleware(t *testing.T) {
+	var traceparent string
+	tries := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		traceparent = req.Header.Get("traceparent")
+		if tries++; tries == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	tracer := &memoryTracer{}
+	meter := &memoryMeter{values: map[string][]float64{}, attrs: map[string][]map[string]interface{}{}}
+	base, _ := url.Parse(server.URL)
+	client, _ := New(base)
+	client.SetRetryPolicy(&RetryPolicy{MaxAttempts: 2, MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond})
+	client.Use(TelemetryMiddleware(Telemetry{Tracer: tracer, Meter: meter}))
+
+	ctx, parent := tracer.Start(context.Background(), "parent")
+	if _, err := client.Get(&Params{Path: "things", Context: ctx}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tracer.spans) != 2 {
+		t.Fatal("Expected one client span: ", len(tracer.spans))
+	}
+	span := tracer.spans[1]
+	if span.name != "GET" || !span.ended || span.parent != parent.SpanContext() {
+		t.Fatal("Wrong span: ", span)
+	}
+	if traceparent != "00-00000000000000000000000000000001-0000000000000002-01" {
+		t.Fatal("Wrong traceparent: ", traceparent)
+	}
+
+	_, portString, _ := net.SplitHostPort(base.Host)
+	port, _ := strconv.Atoi(portString)
+	expected := map[string]interface{}{
+		"http.request.method":       "GET",
+		"url.full":                  server.URL + "/things",
+		"server.address":            "127.0.0.1",
+		"server.port":               port,
+		"http.response.status_code": 404,
+		"http.request.resend_count": 1,
+		"error.type":                "404",
+	}
+	for k, v := range expected {
+		if span.attrs[k] != v {
+			t.Fatal("Wrong span attribute ", k, ": ", span.attrs[k])
+		}
+	}
+	if StatusCode(span.err) != 404 {
+		t.Fatal("Span should be failed: ", span.err)
+	}
+
+	if len(meter.values[MetricRequests]) != 1 || meter.attrs[MetricRequests][0]["http.response.status_code"] != 404 {
+		t.Fatal("Request was not counted: ", meter.attrs[MetricRequests])
+	}
+	if d := meter.values[MetricRequestDuration]; len(d) != 1 || d[0] <= 0 {
+		t.Fatal("Duration was not recorded: ", d)
+	}
+	if a := meter.values[MetricActiveRequests]; len(a) != 2 || a[0] != 1 || a[1] != -1 {
+		t.Fatal("Active requests were not tracked: ", a)
+	}
+}
+
+func TestTelemetryMiddlewareErrors(t *testing.T) {
+	tracer := &memoryTracer{}
+	base, _ := url.Parse("http://localhost:1")
+	client, _ := New(base)
+	client.SetCircuitBreaker(NewCircuitBreaker(1, time.Minute))
+	client.Use(TelemetryMiddleware(Telemetry{Tracer: tracer}))
+
+	client.Get(&Params{})
+	client.Get(&Params{})
+
+	if tracer.spans[0].err == nil || tracer.spans[0].attrs["error.type"] == "" {
+		t.Fatal("Connection error should fail the span: ", tracer.spans[0])
+	}
+	if !errors.Is(tracer.spans[1].err, ErrCircuitOpen) || tracer.spans[1].attrs["error.type"] != "circuit_open" {
+		t.Fatal("Open circuit should fail the span: ", tracer.spans[1].attrs)
+	}
+}
@@ -0,0 +1,44 @@
+package grestclient
+
+import (
+	"encoding/xml"
+	"net/http"
+)
+
+//XmlMarshalerFunc can be used by the client to marshal
+//structs into xml for the request body.
+func XmlMarshalerFunc(v interface{}) (ReadLener, error) {
+	b, err := xml.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return ByteSliceToReadLener(b)
+}
+
+//XmlUnmarshalerFunc can be used to unmarshal response bodies
+//from xml.
+func XmlUnmarshalerFunc(b []byte, v interface{}) error {
+	return xml.Unmarshal(b, v)
+}
+
+//XmlContentTypeMutator sets the Content-Type of the request to be
+//application/xml
+func XmlContentTypeMutator(r *http.Request) error {
+	r.Header.Add("Content-Type", "application/xml")
+	return nil
+}
+
+func XmlAcceptMutator(r *http.Request) error {
+	r.Header.Add("Accept", "application/xml")
+	return nil
+}
+
+//SetupForXml is a convenience method that sets the
+//marshaler and unmarshaler funcs on the client to be the
+//Xml funcs in this package. It also sets the default
+//Content-Type and Accept headers to xml.
+func SetupForXml(c *Client) {
+	c.SetMarshaler(XmlMarshalerFunc)
+	c.SetUnmarshaler(XmlUnmarshalerFunc)
+	setDefaultHeaders(c, "application/xml", "application/xml")
+}